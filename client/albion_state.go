@@ -1,17 +1,15 @@
 package client
 
 import (
-	"strings"
 	"regexp"
+	"strings"
+	"time"
 
 	"github.com/ao-data/albiondata-client/lib"
 	"github.com/ao-data/albiondata-client/log"
 	"github.com/ao-data/albiondata-client/notification"
 )
 
-// CacheSize limit size of messages in cache
-const CacheSize = 8192
-
 type marketHistoryInfo struct {
 	albionId  int32
 	timescale lib.Timescale
@@ -28,12 +26,12 @@ type albionState struct {
 	AODataIngestBaseURL  string
 	WaitingForMarketData bool
 
-	// A lot of information is sent out but not contained in the response when requesting marketHistory (e.g. ID)
-	// This information is stored in marketHistoryInfo
-	// This array acts as a type of cache for that info
-	// The index is the message number (param255) % CacheSize
-	marketHistoryIDLookup [CacheSize]marketHistoryInfo
-	// TODO could this be improved?!
+	// When the data was captured, only set on the copies events hand to the uploaders
+	CapturedAt time.Time
+
+	// A lot of information is sent out but not contained in the response (e.g. the item ID of a
+	// marketHistory request). Requests keep it here, by message number (param255), for their response.
+	pendingRequests *correlationStore
 }
 
 func (state albionState) IsValidLocation() bool {
@@ -105,3 +103,17 @@ func (state albionState) GetServer() (int, string) {
 
 	return serverID, AODataIngestBaseURL
 }
+
+// realmName returns the name of the realm an AODataServerID belongs to
+func realmName(serverID int) string {
+	switch serverID {
+	case 1:
+		return "west"
+	case 2:
+		return "east"
+	case 3:
+		return "europe"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,127 @@
+package client
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ao-data/albiondata-client/log"
+)
+
+// eventBus hands the events published by the operations to everyone interested in them.
+// Every subscriber has its own queue and goroutine, so a slow or failing subscriber
+// does not hold up or break the others.
+type eventBus struct {
+	mu          sync.RWMutex
+	subscribers []*eventSubscriber
+}
+
+type eventSubscriber struct {
+	name    string
+	events  chan Event
+	kinds   map[reflect.Type]bool
+	handler func(Event) error
+
+	// How long publishing waits for room in a full queue before dropping the event
+	wait time.Duration
+
+	// Events dropped because the queue was full
+	dropped uint64
+}
+
+var bus = &eventBus{}
+
+// SubscribeEvents calls the handler for every published event of the given kinds, e.g.
+//
+//	client.SubscribeEvents("overlay", 100, handler, (*client.MarketOrdersCaptured)(nil))
+//
+// or for every event if no kinds are given. The handler is called from its own goroutine, one
+// event at a time. Events that come in while buffer events are waiting are dropped.
+func SubscribeEvents(name string, buffer int, handler func(Event) error, kinds ...Event) {
+	bus.subscribe(name, buffer, 0, handler, kinds...)
+}
+
+// subscribe adds a subscriber. While its queue is full publishing waits up to wait for it,
+// events that still find no room are dropped with a warning.
+func (b *eventBus) subscribe(name string, buffer int, wait time.Duration, handler func(Event) error, kinds ...Event) {
+	s := &eventSubscriber{
+		name:    name,
+		events:  make(chan Event, buffer),
+		handler: handler,
+		wait:    wait,
+	}
+
+	if len(kinds) > 0 {
+		s.kinds = make(map[reflect.Type]bool)
+		for _, kind := range kinds {
+			s.kinds[reflect.TypeOf(kind)] = true
+		}
+	}
+
+	b.mu.Lock()
+	b.subscribers = append(b.subscribers, s)
+	b.mu.Unlock()
+
+	go s.run()
+}
+
+// publish queues an event for every subscriber that wants it
+func (b *eventBus) publish(e Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	kind := reflect.TypeOf(e)
+	for _, s := range b.subscribers {
+		if s.kinds != nil && !s.kinds[kind] {
+			continue
+		}
+
+		if !s.queue(e) {
+			if dropped := atomic.AddUint64(&s.dropped, 1); dropped == 1 || dropped%100 == 0 {
+				log.Warnf("Event subscriber %v does not keep up, dropped %d events so far", s.name, dropped)
+			}
+		}
+	}
+}
+
+// queue returns whether the event found room in the queue within the wait of the subscriber
+func (s *eventSubscriber) queue(e Event) bool {
+	select {
+	case s.events <- e:
+		return true
+	default:
+	}
+
+	if s.wait <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(s.wait)
+	defer timer.Stop()
+
+	select {
+	case s.events <- e:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+func (s *eventSubscriber) run() {
+	for e := range s.events {
+		s.handle(e)
+	}
+}
+
+func (s *eventSubscriber) handle(e Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("Event subscriber %v panicked on %T: %v", s.name, e, r)
+		}
+	}()
+
+	if err := s.handler(e); err != nil {
+		log.Errorf("Event subscriber %v failed on %T: %v", s.name, e, err)
+	}
+}
@@ -0,0 +1,106 @@
+package client
+
+import (
+	"time"
+
+	"github.com/ao-data/albiondata-client/db"
+	"github.com/ao-data/albiondata-client/lib"
+	uuid "github.com/nu7hatch/gouuid"
+)
+
+// Event is something the client captured from the game, published on the event bus
+type Event interface {
+	Context() *EventContext
+}
+
+// EventContext is where and when an event was captured
+type EventContext struct {
+	ServerID      int
+	Realm         string
+	LocationID    string
+	CharacterID   lib.CharacterID
+	CharacterName string
+	Identifier    string
+	CapturedAt    time.Time
+
+	// A copy of the session state, as the uploaders want it
+	state albionState
+}
+
+// Context returns the context of the event
+func (c *EventContext) Context() *EventContext {
+	return c
+}
+
+// newEventContext captures the state of the session for an event, with a new identifier
+func newEventContext(state *albionState) EventContext {
+	identifier, _ := uuid.NewV4()
+	capturedAt := time.Now().UTC()
+
+	ctx := EventContext{
+		ServerID:      state.AODataServerID,
+		Realm:         realmName(state.AODataServerID),
+		LocationID:    state.LocationId,
+		CharacterID:   state.CharacterId,
+		CharacterName: state.CharacterName,
+		Identifier:    identifier.String(),
+		CapturedAt:    capturedAt,
+		state:         *state,
+	}
+	ctx.state.CapturedAt = capturedAt
+	return ctx
+}
+
+// MarketOrdersCaptured is published for the orders of a page of sell offers ("offer") or buy requests ("request")
+type MarketOrdersCaptured struct {
+	EventContext
+	AuctionType string
+	Orders      []*lib.MarketOrder
+}
+
+// MarketSearchCompleted is published for every market search the response of which was seen, even without orders
+type MarketSearchCompleted struct {
+	EventContext
+	Search *db.MarketSearch
+}
+
+// MarketHistoryCaptured is published for the price history of an item
+type MarketHistoryCaptured struct {
+	EventContext
+	History lib.MarketHistoriesUpload
+}
+
+// GoldPricesCaptured is published for the gold price history
+type GoldPricesCaptured struct {
+	EventContext
+	Prices lib.GoldPricesUpload
+}
+
+// MapDataCaptured is published for the information on a zone
+type MapDataCaptured struct {
+	EventContext
+	MapData lib.MapDataUpload
+}
+
+// SkillsCaptured is published for the skills of the character
+type SkillsCaptured struct {
+	EventContext
+	Skills lib.SkillsUpload
+}
+
+// MarketNotificationCaptured is published for a market mail of the character that was read
+type MarketNotificationCaptured struct {
+	EventContext
+	Notification lib.MarketNotificationUpload
+}
+
+// CharacterJoined is published when a character joins a game server, the context holds the character
+type CharacterJoined struct {
+	EventContext
+}
+
+// LocationChanged is published when the character moved to another location, the context holds the new one
+type LocationChanged struct {
+	EventContext
+	From string
+}
@@ -0,0 +1,97 @@
+package client
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ao-data/albiondata-client/db"
+	"github.com/ao-data/albiondata-client/lib"
+	"github.com/ao-data/albiondata-client/log"
+)
+
+const (
+	// Events the built-in subscribers can have waiting
+	subscriberQueueSize = 1000
+
+	// How long capturing waits for a built-in subscriber with a full queue before the event
+	// is dropped, so a stalled disk or target slows capturing down instead of losing data
+	subscriberQueueWait = 10 * time.Second
+)
+
+// subscribeUploads sends the captured data to the uploaders and websockets. The uploads themselves
+// are queued per target, so the subscriber keeps up however long a target takes.
+func subscribeUploads() {
+	bus.subscribe("uploads", subscriberQueueSize, subscriberQueueWait, uploadEvent,
+		(*MarketOrdersCaptured)(nil),
+		(*MarketHistoryCaptured)(nil),
+		(*GoldPricesCaptured)(nil),
+		(*MapDataCaptured)(nil),
+		(*SkillsCaptured)(nil),
+		(*MarketNotificationCaptured)(nil),
+	)
+}
+
+func uploadEvent(e Event) error {
+	ctx := e.Context()
+	state := ctx.state
+
+	switch e := e.(type) {
+	case *MarketOrdersCaptured:
+		kind := "sell"
+		if e.AuctionType == "request" {
+			kind = "buy"
+		}
+		log.Infof("Sending %d live market %s orders to ingest (Identifier: %s)", len(e.Orders), kind, ctx.Identifier)
+		sendMsgToPublicUploaders(lib.MarketUpload{Orders: e.Orders}, lib.NatsMarketOrdersIngest, &state, ctx.Identifier)
+	case *MarketHistoryCaptured:
+		log.Infof("Sending %d market history item average stats to ingest for albionID %d (Identifier: %s)", len(e.History.Histories), e.History.AlbionId, ctx.Identifier)
+		sendMsgToPublicUploaders(e.History, lib.NatsMarketHistoriesIngest, &state, ctx.Identifier)
+	case *GoldPricesCaptured:
+		log.Infof("Sending gold prices to ingest (Identifier: %s)", ctx.Identifier)
+		sendMsgToPublicUploaders(e.Prices, lib.NatsGoldPricesIngest, &state, ctx.Identifier)
+	case *MapDataCaptured:
+		log.Infof("Sending map data to ingest (Identifier: %s)", ctx.Identifier)
+		sendMsgToPublicUploaders(e.MapData, lib.NatsMapDataIngest, &state, ctx.Identifier)
+	case *SkillsCaptured:
+		// Personalizing changes the upload, which the other subscribers share
+		upload := e.Skills
+		log.Infof("Sending %d skills of %v to ingest", len(upload.Skills), ctx.CharacterName)
+		sendMsgToPrivateUploaders(&upload, lib.NatsSkillData, &state, ctx.Identifier)
+	case *MarketNotificationCaptured:
+		upload := e.Notification
+		sendMsgToPrivateUploaders(&upload, lib.NatsMarketNotifications, &state, ctx.Identifier)
+	}
+
+	return nil
+}
+
+// subscribeDatabase saves the captured orders and searches to the local database
+func subscribeDatabase() {
+	bus.subscribe("database", subscriberQueueSize, subscriberQueueWait, saveEvent,
+		(*MarketOrdersCaptured)(nil),
+		(*MarketSearchCompleted)(nil),
+	)
+}
+
+func saveEvent(e Event) error {
+	switch e := e.(type) {
+	case *MarketOrdersCaptured:
+		failed := 0
+		var lastErr error
+		for _, order := range e.Orders {
+			if err := db.InsertMarketOrder(order); err != nil {
+				failed++
+				lastErr = err
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("failed to save %d of %d market orders to database: %v", failed, len(e.Orders), lastErr)
+		}
+	case *MarketSearchCompleted:
+		if err := db.InsertMarketSearch(e.Search); err != nil {
+			return fmt.Errorf("failed to save market search to database: %v", err)
+		}
+	}
+
+	return nil
+}
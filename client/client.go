@@ -24,6 +24,12 @@ func (client *Client) Run() error {
 	log.Info("This is a third-party application and is in no way affiliated with Sandbox Interactive or Albion Online.")
 	log.Info("Additional parameters can listed by calling this file with the -h parameter.")
 
+	if ConfigGlobal.ProtocolMappingPath != "" {
+		if err := loadProtocolMapping(ConfigGlobal.ProtocolMappingPath); err != nil {
+			log.Errorf("Could not load protocol mapping, using the built-in codes: %v", err)
+		}
+	}
+
 	ConfigGlobal.setupDebugEvents()
 	ConfigGlobal.setupDebugOperations()
 
@@ -6,6 +6,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ao-data/albiondata-client/log"
 
@@ -37,6 +38,32 @@ type config struct {
 	PrivateIngestBaseUrls          string
 	PublicIngestBaseUrls           string
 	NoCPULimit                     bool
+	PowTimeout                     time.Duration
+	UploadBatchWindow              time.Duration
+	UploadBatchMaxBytes            int
+	UploadGzip                     bool
+	UploadDedupeTTL                time.Duration
+	NatsUser                       string
+	NatsPassword                   string
+	NatsToken                      string
+	NatsNkeySeed                   string
+	NatsCredentials                string
+	NatsTLSCA                      string
+	NatsTLSCert                    string
+	NatsTLSKey                     string
+	NatsAck                        bool
+	NatsAckTimeout                 time.Duration
+	NatsBufferSize                 int
+	MQTTUser                       string
+	MQTTPassword                   string
+	MQTTClientID                   string
+	MQTTTopicPrefix                string
+	MQTTTopics                     map[string]string
+	MQTTQoS                        int
+	MQTTRetain                     bool
+	WebhookSecret                  string
+	WebhookBearerToken             string
+	UploadRoutes                   routingRules
 	PrintVersion                   bool
 	DatabaseEnabled                bool
 	DatabasePath                   string
@@ -44,6 +71,19 @@ type config struct {
 	GUIAutoRefreshSeconds          int
 	GUIStartMinimized              bool
 	GUIRowsPerPage                 int
+	SpoolEnabled                   bool
+	SpoolPath                      string
+	SpoolMaxAge                    time.Duration
+	SpoolMaxBackoff                time.Duration
+	ServerAddress                  string
+	ServerPort                     int
+	ServerTLSCert                  string
+	ServerTLSKey                   string
+	ServerToken                    string
+	ServerBacklogSize              int
+	ServerBacklogMaxAge            time.Duration
+	ProtocolMappingPath            string
+	CatalogPath                    string
 }
 
 // config global config data
@@ -55,6 +95,25 @@ var ConfigGlobal = &config{
 	GUIAutoRefreshSeconds: 5,
 	GUIStartMinimized:     false,
 	GUIRowsPerPage:        100,
+	SpoolEnabled:          false,
+	SpoolPath:             "./albiondata-spool.db",
+	SpoolMaxAge:           24 * time.Hour,
+	SpoolMaxBackoff:       10 * time.Minute,
+	PowTimeout:            2 * time.Minute,
+	UploadBatchWindow:     0,
+	UploadBatchMaxBytes:   256 * 1024,
+	UploadGzip:            false,
+	UploadDedupeTTL:       0,
+	NatsAck:               false,
+	NatsAckTimeout:        5 * time.Second,
+	NatsBufferSize:        1000,
+	MQTTTopicPrefix:       "albiondata/",
+	MQTTQoS:               0,
+	MQTTRetain:            false,
+	ServerAddress:         "",
+	ServerPort:            8099,
+	ServerBacklogSize:     100,
+	ServerBacklogMaxAge:   0,
 }
 
 func (config *config) SetupFlags() {
@@ -97,6 +156,23 @@ func (config *config) setupWebsocketFlags() {
 	config.EnableWebsockets = viper.GetBool("EnableWebsockets")
 	config.AllowedWSHosts = viper.GetStringSlice("AllowedWebsocketHosts")
 
+	// Read local websocket/HTTP server configuration
+	if viper.IsSet("server.address") {
+		config.ServerAddress = viper.GetString("server.address")
+	}
+	if viper.IsSet("server.port") {
+		config.ServerPort = viper.GetInt("server.port")
+	}
+	config.ServerTLSCert = viper.GetString("server.tls_cert")
+	config.ServerTLSKey = viper.GetString("server.tls_key")
+	config.ServerToken = viper.GetString("server.token")
+	if viper.IsSet("server.backlog_size") {
+		config.ServerBacklogSize = viper.GetInt("server.backlog_size")
+	}
+	if viper.IsSet("server.backlog_max_age") {
+		config.ServerBacklogMaxAge = viper.GetDuration("server.backlog_max_age")
+	}
+
 	// Read database configuration
 	if viper.IsSet("database.enabled") {
 		config.DatabaseEnabled = viper.GetBool("database.enabled")
@@ -118,6 +194,103 @@ func (config *config) setupWebsocketFlags() {
 	if viper.IsSet("gui.rows_per_page") {
 		config.GUIRowsPerPage = viper.GetInt("gui.rows_per_page")
 	}
+
+	// Read upload spool configuration
+	if viper.IsSet("spool.enabled") {
+		config.SpoolEnabled = viper.GetBool("spool.enabled")
+	}
+	if viper.IsSet("spool.path") {
+		config.SpoolPath = viper.GetString("spool.path")
+	}
+	if viper.IsSet("spool.max_age") {
+		config.SpoolMaxAge = viper.GetDuration("spool.max_age")
+	}
+	if viper.IsSet("spool.max_backoff") {
+		config.SpoolMaxBackoff = viper.GetDuration("spool.max_backoff")
+	}
+
+	// Read protocol mapping configuration
+	if viper.IsSet("protocol.mapping") {
+		config.ProtocolMappingPath = viper.GetString("protocol.mapping")
+	}
+
+	// Read proof of work configuration
+	if viper.IsSet("pow.timeout") {
+		config.PowTimeout = viper.GetDuration("pow.timeout")
+	}
+
+	// Read upload batching and compression configuration
+	if viper.IsSet("upload.batch_window") {
+		config.UploadBatchWindow = viper.GetDuration("upload.batch_window")
+	}
+	if viper.IsSet("upload.batch_max_bytes") {
+		config.UploadBatchMaxBytes = viper.GetInt("upload.batch_max_bytes")
+	}
+	if viper.IsSet("upload.gzip") {
+		config.UploadGzip = viper.GetBool("upload.gzip")
+	}
+	if viper.IsSet("upload.dedupe_ttl") {
+		config.UploadDedupeTTL = viper.GetDuration("upload.dedupe_ttl")
+	}
+
+	// Read NATS uploader configuration
+	config.NatsUser = viper.GetString("nats.user")
+	config.NatsPassword = viper.GetString("nats.password")
+	config.NatsToken = viper.GetString("nats.token")
+	config.NatsNkeySeed = viper.GetString("nats.nkey_seed")
+	config.NatsCredentials = viper.GetString("nats.credentials")
+	config.NatsTLSCA = viper.GetString("nats.tls_ca")
+	config.NatsTLSCert = viper.GetString("nats.tls_cert")
+	config.NatsTLSKey = viper.GetString("nats.tls_key")
+	if viper.IsSet("nats.ack") {
+		config.NatsAck = viper.GetBool("nats.ack")
+	}
+	if viper.IsSet("nats.ack_timeout") {
+		config.NatsAckTimeout = viper.GetDuration("nats.ack_timeout")
+	}
+	if viper.IsSet("nats.buffer_size") {
+		config.NatsBufferSize = viper.GetInt("nats.buffer_size")
+	}
+
+	// Read MQTT uploader configuration
+	config.MQTTUser = viper.GetString("mqtt.user")
+	config.MQTTPassword = viper.GetString("mqtt.password")
+	config.MQTTClientID = viper.GetString("mqtt.client_id")
+	if viper.IsSet("mqtt.topic_prefix") {
+		config.MQTTTopicPrefix = viper.GetString("mqtt.topic_prefix")
+	}
+	if viper.IsSet("mqtt.qos") {
+		config.MQTTQoS = viper.GetInt("mqtt.qos")
+	}
+	if viper.IsSet("mqtt.retain") {
+		config.MQTTRetain = viper.GetBool("mqtt.retain")
+	}
+
+	// Topic names contain dots, so they are listed instead of being used as keys
+	var mqttTopics []struct {
+		Topic     string `mapstructure:"topic"`
+		MQTTTopic string `mapstructure:"mqtt_topic"`
+	}
+	if err := viper.UnmarshalKey("mqtt.topics", &mqttTopics); err != nil {
+		log.Errorf("Could not read mqtt.topics: %v", err)
+	}
+	config.MQTTTopics = make(map[string]string)
+	for _, t := range mqttTopics {
+		config.MQTTTopics[t.Topic] = t.MQTTTopic
+	}
+
+	// Read signed webhook configuration
+	config.WebhookSecret = viper.GetString("webhook.secret")
+	config.WebhookBearerToken = viper.GetString("webhook.bearer_token")
+
+	// Read upload routing rules
+	if err := viper.UnmarshalKey("routing", &config.UploadRoutes); err != nil {
+		log.Errorf("Could not read routing rules: %v", err)
+		config.UploadRoutes = nil
+	} else if err := config.UploadRoutes.validate(); err != nil {
+		log.Errorf("Ignoring routing rules: %v", err)
+		config.UploadRoutes = nil
+	}
 }
 
 func (config *config) setupDebugFlags() {
@@ -177,6 +350,20 @@ func (config *config) setupDebugFlags() {
 		"Ignore the decoding errors when debugging",
 	)
 
+	flag.StringVar(
+		&config.ProtocolMappingPath,
+		"mapping",
+		config.ProtocolMappingPath,
+		"Load operation and event codes and param indices from this JSON or YAML file, overriding the built-in ones.",
+	)
+
+	flag.StringVar(
+		&config.CatalogPath,
+		"catalog",
+		"",
+		"Write a catalog of every operation and event code seen, with param types and samples, to this JSON file every minute and serve it at /catalog.",
+	)
+
 	flag.BoolVar(
 		&config.NoCPULimit,
 		"no-limit",
@@ -226,14 +413,14 @@ func (config *config) setupCommonFlags() {
 		&config.PublicIngestBaseUrls,
 		"i",
 		"https+pow://albion-online-data.com",
-		"Base URL to send PUBLIC data to, can be 'nats://', 'http://', 'https://' or 'noop' and can have multiple uploaders. Comma separated.",
+		"Base URL to send PUBLIC data to, can be 'nats://', 'http://', 'https://', 'mqtt://', 'mqtts://', 'file://' or 'noop' and can have multiple uploaders. Comma separated.",
 	)
 
 	flag.StringVar(
 		&config.PrivateIngestBaseUrls,
 		"p",
 		"",
-		"Base URL to send PRIVATE data to, can be 'nats://', 'http://', 'https://' or 'noop' and can have multiple uploaders. Comma separated.",
+		"Base URL to send PRIVATE data to, can be 'nats://', 'http://', 'https://', 'http+signed://', 'https+signed://', 'mqtt://', 'mqtts://', 'file://' or 'noop' and can have multiple uploaders. Comma separated.",
 	)
 
 	flag.StringVar(
@@ -299,7 +486,7 @@ func (config *config) setupDebugEvents() {
 		if shouldDebug {
 			verb = "Showing"
 		}
-		log.Debugf("[%v] event: [%v]%v", verb, number, EventType(number))
+		log.Debugf("[%v] event: [%v]%v", verb, number, eventName(int16(number)))
 	}
 
 }
@@ -330,7 +517,7 @@ func (config *config) setupDebugOperations() {
 		if shouldDebug {
 			verb = "Showing"
 		}
-		log.Debugf("[%v] operation: [%v]%v", verb, number, OperationType(number))
+		log.Debugf("[%v] operation: [%v]%v", verb, number, operationName(int16(number)))
 	}
 
 }
@@ -0,0 +1,104 @@
+package client
+
+import (
+	"time"
+)
+
+// correlatedResponse is implemented by responses that want the request they answer,
+// usually by embedding responseTo
+type correlatedResponse interface {
+	operation
+	setRequest(request operation)
+}
+
+// responseTo holds the request a response answers, nil if it was not seen
+type responseTo struct {
+	request operation
+}
+
+func (r *responseTo) setRequest(request operation) {
+	r.request = request
+}
+
+// messageID returns the message ID (param 255) of a request or response
+func messageID(params map[uint8]interface{}) (uint64, bool) {
+	switch id := params[255].(type) {
+	case int8:
+		return uint64(id), true
+	case uint8:
+		return uint64(id), true
+	case int16:
+		return uint64(id), true
+	case uint16:
+		return uint64(id), true
+	case int32:
+		return uint64(id), true
+	case uint32:
+		return uint64(id), true
+	case int64:
+		return uint64(id), true
+	case uint64:
+		return id, true
+	case int:
+		return uint64(id), true
+	}
+	return 0, false
+}
+
+// How long a request waits for its response before it is forgotten.
+const correlationTTL = 2 * time.Minute
+
+type correlationEntry struct {
+	request operation
+	expires time.Time
+}
+
+// correlationStore remembers the requests until their response, with the same message ID
+// (param 255), comes in. It belongs to a session, so it is only used by one worker at a time.
+type correlationStore struct {
+	ttl       time.Duration
+	entries   map[uint64]correlationEntry
+	nextPrune time.Time
+}
+
+func newCorrelationStore(ttl time.Duration) *correlationStore {
+	return &correlationStore{
+		ttl:     ttl,
+		entries: make(map[uint64]correlationEntry),
+	}
+}
+
+// put remembers a request until its response comes in
+func (c *correlationStore) put(messageID uint64, request operation) {
+	now := time.Now()
+	c.prune(now)
+	c.entries[messageID] = correlationEntry{request: request, expires: now.Add(c.ttl)}
+}
+
+// take returns and forgets the request of a message, if it did not expire yet
+func (c *correlationStore) take(messageID uint64) (operation, bool) {
+	entry, ok := c.entries[messageID]
+	if !ok {
+		return nil, false
+	}
+	delete(c.entries, messageID)
+
+	if time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.request, true
+}
+
+// prune drops the expired entries, at most once per ttl
+func (c *correlationStore) prune(now time.Time) {
+	if now.Before(c.nextPrune) {
+		return
+	}
+	c.nextPrune = now.Add(c.ttl)
+
+	for id, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, id)
+		}
+	}
+}
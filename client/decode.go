@@ -10,97 +10,28 @@ import (
 	"github.com/mitchellh/mapstructure"
 )
 
-func decodeRequest(params map[uint8]interface{}) (operation operation, err error) {
+func decodeRequest(params map[uint8]interface{}) (operations []operation, err error) {
 	if _, ok := params[253]; !ok {
 		return nil, nil
 	}
 
-	code := params[253].(int16)
-
-	switch OperationType(code) {
-	case opGetGameServerByCluster:
-		operation = &operationGetGameServerByCluster{}
-	case opAuctionGetOffers:
-		operation = &operationAuctionGetOffers{}
-	case opAuctionGetItemAverageStats:
-		operation = &operationAuctionGetItemAverageStats{}
-	case opGetClusterMapInfo:
-		operation = &operationGetClusterMapInfo{}
-	// case opGoldMarketGetAverageInfo:
-	case opGoldMarketGetAverageInfo:
-		operation = &operationGoldMarketGetAverageInfo{}
-	case opRealEstateGetAuctionData:
-		operation = &operationRealEstateGetAuctionData{}
-	case opRealEstateBidOnAuction:
-		operation = &operationRealEstateBidOnAuction{}
-	default:
-		return nil, nil
-	}
-
-	err = decodeParams(params, operation)
-
-	return operation, err
+	return decodeMessage(directionRequest, params[253].(int16), params)
 }
 
-func decodeResponse(params map[uint8]interface{}) (operation operation, err error) {
+func decodeResponse(params map[uint8]interface{}) (operations []operation, err error) {
 	if _, ok := params[253]; !ok {
 		return nil, nil
 	}
 
-	code := params[253].(int16)
-
-	switch OperationType(code) {
-	case opJoin:
-		operation = &operationJoinResponse{}
-	case opAuctionGetOffers:
-		operation = &operationAuctionGetOffersResponse{}
-	case opAuctionGetRequests:
-		operation = &operationAuctionGetRequestsResponse{}
-	case opAuctionBuyOffer:
-		operation = &operationAuctionGetRequestsResponse{}
-	case opAuctionGetItemAverageStats:
-		operation = &operationAuctionGetItemAverageStatsResponse{}
-	case opGetMailInfos:
-		operation = &operationGetMailInfosResponse{}
-	case opReadMail:
-		operation = &operationReadMail{}
-	case opGetClusterMapInfo:
-		operation = &operationGetClusterMapInfoResponse{}
-	// case opGoldMarketGetAverageInfo:
-	case opGoldMarketGetAverageInfo:
-		operation = &operationGoldMarketGetAverageInfoResponse{}
-	case opRealEstateGetAuctionData:
-		operation = &operationRealEstateGetAuctionDataResponse{}
-	case opRealEstateBidOnAuction:
-		operation = &operationRealEstateBidOnAuctionResponse{}
-	default:
-		return nil, nil
-	}
-
-	err = decodeParams(params, operation)
-
-	return operation, err
+	return decodeMessage(directionResponse, params[253].(int16), params)
 }
 
-func decodeEvent(params map[uint8]interface{}) (event operation, err error) {
+func decodeEvent(params map[uint8]interface{}) (events []operation, err error) {
 	if _, ok := params[252]; !ok {
 		return nil, nil
 	}
 
-	eventType := params[252].(int16)
-
-	switch eventType {
-	// case evRespawn: //TODO: confirm this eventCode (old 77)
-	// 	event = &eventPlayerOnlineStatus{}
-	// case evCharacterStats: //TODO: confirm this eventCode (old 114)
-	// 	event = &eventSkillData{}
-	default:
-		return nil, nil
-	}
-
-	err = decodeParams(params, event)
-
-	return event, err
+	return decodeMessage(directionEvent, params[252].(int16), params)
 }
 
 func decodeParams(params map[uint8]interface{}, operation operation) error {
@@ -132,6 +63,15 @@ func decodeParams(params map[uint8]interface{}, operation operation) error {
 		stringMap[strconv.Itoa(int(k))] = v
 	}
 
+	// Fields the protocol mapping moved are decoded from their new param
+	for tag, index := range paramOverrides[reflect.TypeOf(operation)] {
+		if v, ok := params[index]; ok {
+			stringMap[tag] = v
+		} else {
+			delete(stringMap, tag)
+		}
+	}
+
 	err = decoder.Decode(stringMap)
 
 	return err
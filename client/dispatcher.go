@@ -1,25 +1,54 @@
 package client
 
 import (
+	"crypto/subtle"
 	"encoding/json"
+	"net"
 	"net/http"
-
+	"strconv"
 	"strings"
+	"sync"
 
+	"github.com/ao-data/albiondata-client/db"
 	"github.com/ao-data/albiondata-client/lib"
 	"github.com/ao-data/albiondata-client/log"
 )
 
 type dispatcher struct{}
 
+const publicIngestPlaceholder = "https+pow://albion-online-data.com"
+
 var (
 	wsHub *WSHub
 	dis   *dispatcher
+
+	uploaderCacheMu sync.Mutex
+	uploaderCache   = make(map[string]uploader)
 )
 
 func createDispatcher() {
 	dis = &dispatcher{}
 
+	if ConfigGlobal.SpoolEnabled && !ConfigGlobal.DisableUpload {
+		err := openUploadSpool(ConfigGlobal.SpoolPath)
+		if err != nil {
+			log.Errorf("Failed to open upload spool: %v", err)
+			log.Error("Continuing without upload spool...")
+		} else {
+			log.Infof("Upload spool opened at: %s", ConfigGlobal.SpoolPath)
+			go uploadSpool.run()
+		}
+	}
+
+	if ConfigGlobal.UploadDedupeTTL > 0 {
+		uploadDedupe = newUploadDeduper(ConfigGlobal.UploadDedupeTTL)
+	}
+
+	subscribeUploads()
+	if db.DB != nil {
+		subscribeDatabase()
+	}
+
 	if ConfigGlobal.EnableWebsockets {
 		wsHub = newHub()
 		go wsHub.run()
@@ -27,31 +56,98 @@ func createDispatcher() {
 	}
 }
 
-func createUploaders(targets []string) []uploader {
+// createUploaders returns the uploaders of the targets the routing rules allow for the topic
+func createUploaders(targets []string, topic string, state *albionState) []uploader {
 	var uploaders []uploader
 	for _, target := range targets {
-		if target == "" {
+		if !ConfigGlobal.UploadRoutes.allows(target, topic, realmName(state.AODataServerID)) {
+			log.Tracef("Routing rules skip %v for %v", topic, target)
 			continue
 		}
-		if len(target) < 4 {
-			log.Infof("Got an ingest target that was less than 4 characters, not a valid ingest target: %v", target)
+
+		target = resolveIngestTarget(target, state)
+
+		u := getUploader(target)
+		if u == nil {
 			continue
 		}
 
-		if target[0:8] == "http+pow" ||  target[0:9] == "https+pow" {
-			uploaders = append(uploaders, newHTTPUploaderPow(target))
-		} else if target[0:4] == "http" || target[0:5] == "https" {
-			uploaders = append(uploaders, newHTTPUploader(target))
-		} else if target[0:4] == "nats" {
-			uploaders = append(uploaders, newNATSUploader(target))
-		} else {
-			log.Infof("An invalid ingest target was specified: %v", target)
+		// Uploads that fail once the queue sends them
+		if uploadSpool != nil {
+			u = &spooledUploader{target: target, next: u, spool: uploadSpool}
+		}
+
+		if ConfigGlobal.UploadBatchWindow > 0 {
+			u = getUploadBatcher(target, u)
 		}
+
+		u = getUploadQueue(target, u)
+
+		// Uploads the queue turns away while the target does not keep up
+		if uploadSpool != nil {
+			u = &spooledUploader{target: target, next: u, spool: uploadSpool}
+		}
+
+		uploaders = append(uploaders, u)
 	}
 
 	return uploaders
 }
 
+// resolveIngestTarget replaces the public placeholder target with the one of the realm we are playing on
+func resolveIngestTarget(target string, state *albionState) string {
+	// https+pow://albion-online-data.com is used as a magic placeholder for every realm there is
+	if strings.Contains(target, publicIngestPlaceholder) {
+		// we replace the placeholder with the correct one based on the serverID from albionState
+		return strings.Replace(target, publicIngestPlaceholder, state.AODataIngestBaseURL, -1)
+	}
+	return target
+}
+
+// getUploader returns the uploader for a target, reusing the one created by an earlier call
+// so connections and other per-target state survive between messages
+func getUploader(target string) uploader {
+	uploaderCacheMu.Lock()
+	defer uploaderCacheMu.Unlock()
+
+	if u, ok := uploaderCache[target]; ok {
+		return u
+	}
+
+	u := newUploader(target)
+	if u != nil {
+		uploaderCache[target] = u
+	}
+	return u
+}
+
+func newUploader(target string) uploader {
+	if target == "" {
+		return nil
+	}
+	if len(target) < 4 {
+		log.Infof("Got an ingest target that was less than 4 characters, not a valid ingest target: %v", target)
+		return nil
+	}
+
+	if strings.HasPrefix(target, "http+pow") || strings.HasPrefix(target, "https+pow") {
+		return newHTTPUploaderPow(target)
+	} else if strings.HasPrefix(target, "http+signed") || strings.HasPrefix(target, "https+signed") {
+		return newHTTPUploaderSigned(target)
+	} else if strings.HasPrefix(target, "http") {
+		return newHTTPUploader(target)
+	} else if strings.HasPrefix(target, "nats") {
+		return newNATSUploader(target)
+	} else if strings.HasPrefix(target, "mqtt://") || strings.HasPrefix(target, "mqtts://") {
+		return newMQTTUploader(target)
+	} else if strings.HasPrefix(target, "file://") {
+		return newFileUploader(target)
+	}
+
+	log.Infof("An invalid ingest target was specified: %v", target)
+	return nil
+}
+
 func sendMsgToPublicUploaders(upload interface{}, topic string, state *albionState, identifier string) {
 	data, err := json.Marshal(upload)
 	if err != nil {
@@ -59,22 +155,17 @@ func sendMsgToPublicUploaders(upload interface{}, topic string, state *albionSta
 		return
 	}
 
-	var PublicIngestBaseUrls = ConfigGlobal.PublicIngestBaseUrls
-	// http+pow://albion-online-data.com is used as a magic placeholder for every realm there is
-	if strings.Contains(ConfigGlobal.PublicIngestBaseUrls, "https+pow://albion-online-data.com") {
-		// we replace the placeholder with the correct one based on the serverID from albionState
-		PublicIngestBaseUrls = strings.Replace(PublicIngestBaseUrls, "https+pow://albion-online-data.com", state.AODataIngestBaseURL, -1)
-	}
-
-	var publicUploaders = createUploaders(strings.Split(PublicIngestBaseUrls, ","))
-	var privateUploaders = createUploaders(strings.Split(ConfigGlobal.PrivateIngestBaseUrls, ","))
+	if uploadDedupe == nil || !uploadDedupe.isDuplicate(topic, state.AODataServerID, data) {
+		var publicUploaders = createUploaders(strings.Split(ConfigGlobal.PublicIngestBaseUrls, ","), topic, state)
+		var privateUploaders = createUploaders(strings.Split(ConfigGlobal.PrivateIngestBaseUrls, ","), topic, state)
 
-	sendMsgToUploaders(data, topic, publicUploaders, state, identifier)
-	sendMsgToUploaders(data, topic, privateUploaders, state, identifier)
+		sendMsgToUploaders(data, topic, publicUploaders, state, identifier)
+		sendMsgToUploaders(data, topic, privateUploaders, state, identifier)
+	}
 
 	// If websockets are enabled, send the data there too
 	if ConfigGlobal.EnableWebsockets {
-		sendMsgToWebSockets(data, topic)
+		sendMsgToWebSockets(data, topic, state, identifier, false)
 	}
 }
 
@@ -100,14 +191,14 @@ func sendMsgToPrivateUploaders(upload lib.PersonalizedUpload, topic string, stat
 		return
 	}
 
-	var privateUploaders = createUploaders(strings.Split(ConfigGlobal.PrivateIngestBaseUrls, ","))
-	if len(privateUploaders) > 0 {
+	var privateUploaders = createUploaders(strings.Split(ConfigGlobal.PrivateIngestBaseUrls, ","), topic, state)
+	if len(privateUploaders) > 0 && (uploadDedupe == nil || !uploadDedupe.isDuplicate(topic, state.AODataServerID, data)) {
 		sendMsgToUploaders(data, topic, privateUploaders, state, identifier)
 	}
 
 	// If websockets are enabled, send the data there too
 	if ConfigGlobal.EnableWebsockets {
-		sendMsgToWebSockets(data, topic)
+		sendMsgToWebSockets(data, topic, state, identifier, true)
 	}
 }
 
@@ -118,26 +209,80 @@ func sendMsgToUploaders(msg []byte, topic string, uploaders []uploader, state *a
 	}
 
 	for _, u := range uploaders {
-		u.sendToIngest(msg, topic, state, identifier)
+		if err := u.sendToIngest(msg, topic, state, identifier); err != nil {
+			log.Errorf("Error while sending %v to ingest: %v", topic, err)
+		}
 	}
 }
 
 func runHTTPServer() {
-	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
 		serveWs(wsHub, w, r)
 	})
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		serveSSE(wsHub, w, r)
+	})
+	mux.HandleFunc("/schema/", serveSchema)
+	if catalogServed() {
+		mux.HandleFunc("/catalog", serveCatalog)
+	}
+	mux.HandleFunc("/stats", serveStats)
+
+	addr := net.JoinHostPort(ConfigGlobal.ServerAddress, strconv.Itoa(ConfigGlobal.ServerPort))
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		// Another client probably has the port, keep capturing and uploading without the local server
+		log.Errorf("Could not listen on %v, websockets and events are disabled: %v", addr, err)
+		return
+	}
+
+	server := &http.Server{Handler: requireToken(ConfigGlobal.ServerToken, mux)}
 
-	err := http.ListenAndServe(":8099", nil)
+	useTLS := ConfigGlobal.ServerTLSCert != "" && ConfigGlobal.ServerTLSKey != ""
+	if !useTLS && (ConfigGlobal.ServerTLSCert != "" || ConfigGlobal.ServerTLSKey != "") {
+		log.Warn("TLS needs both server.tls_cert and server.tls_key, serving without TLS")
+	}
+	if useTLS {
+		log.Infof("Serving websockets and events on https://%v", addr)
+		err = server.ServeTLS(listener, ConfigGlobal.ServerTLSCert, ConfigGlobal.ServerTLSKey)
+	} else {
+		log.Infof("Serving websockets and events on http://%v", addr)
+		err = server.Serve(listener)
+	}
 
 	if err != nil {
-		log.Panic("ListenAndServe: ", err)
+		log.Errorf("Local server on %v stopped: %v", addr, err)
 	}
 }
 
-func sendMsgToWebSockets(msg []byte, topic string) {
-	// TODO (gradius): send JSON data with topic string
-	// TODO (gradius): this seems super hacky, and I'm sure there's a better way.
-	var result string
-	result = "{\"topic\": \"" + topic + "\", \"data\": " + string(msg) + "}"
-	wsHub.broadcast <- []byte(result)
+// requireToken rejects requests without the access token, if one is configured. Browsers can't
+// set headers on websockets and EventSource, so the token can also be given as ?token=
+func requireToken(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given := r.URL.Query().Get("token")
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			given = strings.TrimPrefix(auth, "Bearer ")
+		}
+
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func sendMsgToWebSockets(msg []byte, topic string, state *albionState, identifier string, private bool) {
+	result, err := json.Marshal(newWSEnvelope(msg, topic, state, identifier, private))
+	if err != nil {
+		log.Errorf("Error while marshalling websocket message for %v: %v", topic, err)
+		return
+	}
+	wsHub.broadcast <- newWSMessage(topic, msg, state, result)
 }
@@ -5,6 +5,11 @@ import (
 	"github.com/ao-data/albiondata-client/log"
 )
 
+// TODO: register once the event code is confirmed (old 77)
+// func init() {
+// 	registerEvent(evRespawn, func() operation { return &eventPlayerOnlineStatus{} })
+// }
+
 type eventPlayerOnlineStatus struct {
 	CharacterID   lib.CharacterID `mapstructure:"0"`
 	CharacterName string          `mapstructure:"1"`
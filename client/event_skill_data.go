@@ -5,9 +5,13 @@ import (
 
 	"github.com/ao-data/albiondata-client/lib"
 	"github.com/ao-data/albiondata-client/log"
-	uuid "github.com/nu7hatch/gouuid"
 )
 
+// TODO: register once the event code is confirmed (old 114)
+// func init() {
+// 	registerEvent(evCharacterStats, func() operation { return &eventSkillData{} })
+// }
+
 type eventSkillData struct {
 	SkillIds    []int     `mapstructure:"1"`
 	Levels      []int     `mapstructure:"2"`
@@ -44,7 +48,8 @@ func (event eventSkillData) Process(state *albionState) {
 		Skills: skills,
 	}
 
-	identifier, _ := uuid.NewV4()
-	log.Infof("Sending %d skills of %v to ingest", len(skills), state.CharacterName)
-	sendMsgToPrivateUploaders(&upload, lib.NatsSkillData, state, identifier.String())
+	bus.publish(&SkillsCaptured{
+		EventContext: newEventContext(state),
+		Skills:       upload,
+	})
 }
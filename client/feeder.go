@@ -0,0 +1,56 @@
+package client
+
+import (
+	photon "github.com/ao-data/photon_spectator"
+)
+
+// Feeder hands commands to a listener as if they were captured from a game server, e.g. ones
+// built with photonsynth for simulations and load tests. What they result in is published on
+// the event bus, see SubscribeEvents. The bus is the one of the client, so in a process that
+// also runs the client, fed market orders and other data are uploaded to the configured
+// ingest servers like captured ones.
+type Feeder struct {
+	listener *listener
+	session  *session
+}
+
+// NewFeeder returns a feeder for a game server, whose address decides the realm.
+// Close it when done, it has its own workers processing what was fed.
+func NewFeeder(serverIP string) *Feeder {
+	l := newListener(newRouter())
+	key, _ := sessionKey(serverIP, photonPorts[len(photonPorts)-1], "", 0)
+
+	return &Feeder{
+		listener: l,
+		session:  l.router.session(key, serverIP),
+	}
+}
+
+// Feed handles reliable, unreliable and fragmented commands like the ones of a captured packet
+func (f *Feeder) Feed(commands ...photon.PhotonCommand) {
+	for _, command := range commands {
+		f.listener.onCommand(f.session, command)
+	}
+}
+
+// Flush returns once the commands fed so far have been processed. Subscribers may still be
+// handling the events published for them.
+func (f *Feeder) Flush() {
+	done := make(chan struct{})
+	f.session.enqueue(feederFlush{done: done})
+	<-done
+}
+
+type feederFlush struct {
+	done chan struct{}
+}
+
+func (f feederFlush) Process(state *albionState) {
+	close(f.done)
+}
+
+// Close stops the workers of the feeder once the commands fed so far have been processed.
+// The feeder can't be used afterwards.
+func (f *Feeder) Close() {
+	f.listener.router.pool.close()
+}
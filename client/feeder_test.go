@@ -0,0 +1,25 @@
+package client
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestFeederCloseStopsWorkers(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	for i := 0; i < 3; i++ {
+		f := NewFeeder("")
+		f.Flush()
+		f.Close()
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines left running after closing the feeders, %d before", runtime.NumGoroutine(), before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,238 @@
+package client
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	photon "github.com/ao-data/photon_spectator"
+)
+
+// The recordings in testdata are replayed through the listener, and what would have been uploaded
+// or saved is compared with the .golden.json file next to each. New recordings are made with -record
+// or photonsynth.GobWriter, their golden files with go test ./client -run TestGolden -update.
+var update = flag.Bool("update", false, "write the .golden.json files of the recordings in testdata instead of comparing them")
+
+// Time to wait for the replayed commands to be processed and uploaded.
+const goldenTimeout = 30 * time.Second
+
+// Targets the uploads of the replay go to
+var goldenTargets = []string{"golden://public", "golden://private"}
+
+// goldenRecord is something the replay would have uploaded or saved
+type goldenRecord struct {
+	Target  string          `json:"target"`
+	Topic   string          `json:"topic"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// goldenRecorder takes the place of the uploaders and the database
+type goldenRecorder struct {
+	mu      sync.Mutex
+	records []goldenRecord
+}
+
+var golden = &goldenRecorder{}
+
+func (g *goldenRecorder) add(target string, topic string, payload []byte) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.records = append(g.records, goldenRecord{Target: target, Topic: topic, Payload: append(json.RawMessage(nil), payload...)})
+}
+
+// take returns the records so far by target. Every target is uploaded to by a goroutine of its
+// own, which keeps the order within a target but not between them.
+func (g *goldenRecorder) take() []goldenRecord {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	records := g.records
+	g.records = nil
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Target < records[j].Target
+	})
+	return records
+}
+
+// goldenUploader is an in-memory uploader for the golden:// targets
+type goldenUploader struct {
+	target string
+}
+
+func (u *goldenUploader) sendToIngest(body []byte, topic string, state *albionState, identifier string) error {
+	golden.add(u.target, topic, body)
+	return nil
+}
+
+// goldenFlush is queued after the replayed commands, it is processed once they all were
+type goldenFlush struct {
+	done chan struct{}
+}
+
+func (f goldenFlush) Process(state *albionState) {
+	bus.publish(&goldenFlushed{EventContext: newEventContext(state), done: f.done})
+}
+
+// goldenFlushed is published by goldenFlush, it reaches the recorder after every event published before it
+type goldenFlushed struct {
+	EventContext
+	done chan struct{}
+}
+
+var goldenSubscribe sync.Once
+
+// setupGolden swaps the uploaders and the database for the recorder while the test runs
+func setupGolden(t *testing.T) {
+	// One subscriber for uploads and storage keeps the records in the order the events were published
+	goldenSubscribe.Do(func() {
+		bus.subscribe("golden", subscriberQueueSize, subscriberQueueWait, func(e Event) error {
+			switch e := e.(type) {
+			case *goldenFlushed:
+				close(e.done)
+				return nil
+			case *MarketOrdersCaptured:
+				saveGolden("market_orders", e.Orders)
+			case *MarketSearchCompleted:
+				saveGolden("market_searches", e.Search)
+			}
+			return uploadEvent(e)
+		})
+	})
+
+	public, private := ConfigGlobal.PublicIngestBaseUrls, ConfigGlobal.PrivateIngestBaseUrls
+	ConfigGlobal.PublicIngestBaseUrls, ConfigGlobal.PrivateIngestBaseUrls = goldenTargets[0], goldenTargets[1]
+
+	uploaderCacheMu.Lock()
+	for _, target := range goldenTargets {
+		uploaderCache[target] = &goldenUploader{target: strings.TrimPrefix(target, "golden://")}
+	}
+	uploaderCacheMu.Unlock()
+
+	t.Cleanup(func() {
+		ConfigGlobal.PublicIngestBaseUrls, ConfigGlobal.PrivateIngestBaseUrls = public, private
+
+		uploaderCacheMu.Lock()
+		for _, target := range goldenTargets {
+			delete(uploaderCache, target)
+		}
+		uploaderCacheMu.Unlock()
+	})
+}
+
+// saveGolden records what would have been saved to the database
+func saveGolden(table string, rows interface{}) {
+	data, err := json.Marshal(rows)
+	if err != nil {
+		panic(err)
+	}
+	golden.add("database", table, data)
+}
+
+func TestGolden(t *testing.T) {
+	recordings, err := filepath.Glob(filepath.Join("testdata", "*.gob"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recordings) == 0 {
+		t.Fatal("no .gob recordings in testdata")
+	}
+
+	setupGolden(t)
+
+	for _, recording := range recordings {
+		recording := recording
+		t.Run(filepath.Base(recording), func(t *testing.T) {
+			actual, err := replayGolden(recording)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			goldenPath := strings.TrimSuffix(recording, ".gob") + ".golden.json"
+			if *update {
+				if err := ioutil.WriteFile(goldenPath, actual, 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			expected, err := ioutil.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("%v, create it with -update", err)
+			}
+			if !bytes.Equal(bytes.TrimSpace(expected), bytes.TrimSpace(actual)) {
+				t.Errorf("does not match %v, got\n%s", goldenPath, actual)
+			}
+		})
+	}
+}
+
+// replayGolden feeds a recording to a new listener, so no state is carried over from the one
+// before, and returns what was recorded as indented JSON
+func replayGolden(recording string) ([]byte, error) {
+	commands, err := readCommandGob(recording)
+	if err != nil {
+		return nil, err
+	}
+
+	f := NewFeeder("")
+	defer f.Close()
+	f.Feed(commands...)
+
+	done := make(chan struct{})
+	f.session.enqueue(goldenFlush{done: done})
+	select {
+	case <-done:
+	case <-time.After(goldenTimeout):
+		return nil, fmt.Errorf("commands were not processed within %v", goldenTimeout)
+	}
+
+	// The flush went through the subscriber after every upload was queued
+	uploadQueuesMu.Lock()
+	for _, target := range goldenTargets {
+		if q, ok := uploadQueues[target]; ok {
+			q.pending.Wait()
+		}
+	}
+	uploadQueuesMu.Unlock()
+
+	actual, err := json.MarshalIndent(golden.take(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(actual, '\n'), nil
+}
+
+// readCommandGob reads the commands of a recording made with -record
+func readCommandGob(path string) ([]photon.PhotonCommand, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var commands []photon.PhotonCommand
+	decoder := gob.NewDecoder(file)
+	for {
+		var command photon.PhotonCommand
+		if err := decoder.Decode(&command); err != nil {
+			if err == io.EOF {
+				return commands, nil
+			}
+			return nil, fmt.Errorf("could not decode command %d: %v", len(commands), err)
+		}
+		commands = append(commands, command)
+	}
+}
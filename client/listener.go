@@ -135,7 +135,8 @@ func (l *listener) run() {
 				return
 			}
 		case command := <-l.commands:
-			l.onReliableCommand(&command)
+			// Recorded commands don't say where they came from, so they all share one session
+			l.onReliableCommand(l.router.session("offline", ""), &command)
 		}
 	}
 }
@@ -163,10 +164,17 @@ func (l *listener) processPacket(packet gopacket.Packet) {
 		log.Trace("No IPv4 detected")
 		return
 	}
-	l.router.albionstate.GameServerIP = ipv4.SrcIP.String()
-	l.router.albionstate.AODataServerID, l.router.albionstate.AODataIngestBaseURL = l.router.albionstate.GetServer()
-	log.Tracef("Server ID: %s", l.router.albionstate.AODataServerID)
-	log.Tracef("Using AODataIngestBaseURL: %s", l.router.albionstate.AODataIngestBaseURL)
+
+	var srcPort, dstPort int
+	switch transport := packet.TransportLayer().(type) {
+	case *layers.UDP:
+		srcPort, dstPort = int(transport.SrcPort), int(transport.DstPort)
+	case *layers.TCP:
+		srcPort, dstPort = int(transport.SrcPort), int(transport.DstPort)
+	}
+	key, serverIP := sessionKey(ipv4.SrcIP.String(), srcPort, ipv4.DstIP.String(), dstPort)
+	session := l.router.session(key, serverIP)
+	log.Tracef("Session: %s", key)
 
 	layer := packet.Layer(photon.PhotonLayerType)
 
@@ -177,27 +185,31 @@ func (l *listener) processPacket(packet gopacket.Packet) {
 	content, _ := layer.(photon.PhotonLayer)
 
 	for _, command := range content.Commands {
-		switch command.Type {
-		case photon.SendReliableType:
-			l.onReliableCommand(&command)
-		case photon.SendUnreliableType:
-			var s = make([]byte, len(command.Data)-4)
-			copy(s, command.Data[4:])
-			command.Data = s
-			command.Length -= 4
-			command.Type = 6
-			l.onReliableCommand(&command)
-		case photon.SendReliableFragmentType:
-			msg, _ := command.ReliableFragment()
-			result := l.fragments.Offer(msg)
-			if result != nil {
-				l.onReliableCommand(result)
-			}
+		l.onCommand(session, command)
+	}
+}
+
+func (l *listener) onCommand(session *session, command photon.PhotonCommand) {
+	switch command.Type {
+	case photon.SendReliableType:
+		l.onReliableCommand(session, &command)
+	case photon.SendUnreliableType:
+		var s = make([]byte, len(command.Data)-4)
+		copy(s, command.Data[4:])
+		command.Data = s
+		command.Length -= 4
+		command.Type = 6
+		l.onReliableCommand(session, &command)
+	case photon.SendReliableFragmentType:
+		msg, _ := command.ReliableFragment()
+		result := l.fragments.Offer(msg)
+		if result != nil {
+			l.onReliableCommand(session, result)
 		}
 	}
 }
 
-func (l *listener) onReliableCommand(command *photon.PhotonCommand) {
+func (l *listener) onReliableCommand(session *session, command *photon.PhotonCommand) {
 	// Record all photon commands even if the params did not parse correctly
 	if ConfigGlobal.RecordPath != "" {
 		l.router.recordPhotonCommand <- *command
@@ -206,9 +218,8 @@ func (l *listener) onReliableCommand(command *photon.PhotonCommand) {
 	msg, err := command.ReliableMessage()
 	if err != nil {
 
-		if fmt.Sprint(err) == "Encryption not supported" && l.router.albionstate.WaitingForMarketData == true {
-			l.router.albionstate.WaitingForMarketData = false
-			log.Info("Market data is encrypted. Please see https://www.albion-online-data.com/client/encryption.html for more information.")
+		if fmt.Sprint(err) == "Encryption not supported" {
+			session.enqueue(operationUndecryptable{})
 		}
 
 		if !ConfigGlobal.DebugIgnoreDecodingErrors {
@@ -224,38 +235,48 @@ func (l *listener) onReliableCommand(command *photon.PhotonCommand) {
 		return
 	}
 
-	var operation operation
+	var operations []operation
+	var direction messageDirection
 
 	switch msg.Type {
 	case photon.OperationRequest:
-		operation, err = decodeRequest(params)
+		direction = directionRequest
+		operations, err = decodeRequest(params)
 		if params[253] != nil {
 			number := params[253].(int16)
+			protocolDrift.observe(direction, number, params)
+			catalog.record(direction, number, params, len(operations) > 0)
 			shouldDebug, exists := ConfigGlobal.DebugOperations[int(number)]
 			if (exists && shouldDebug) || (!exists && ConfigGlobal.DebugOperationsString == "") {
-				log.Debugf("OperationRequest: [%v]%v - %v", number, OperationType(number), params)
+				log.Debugf("OperationRequest: [%v]%v - %v", number, operationName(number), params)
 			}
 		} else if !ConfigGlobal.DebugIgnoreDecodingErrors {
 			log.Debugf("OperationRequest: ERROR - %v", params)
 		}
 	case photon.OperationResponse:
-		operation, err = decodeResponse(params)
+		direction = directionResponse
+		operations, err = decodeResponse(params)
 		if params[253] != nil {
 			number := params[253].(int16)
+			protocolDrift.observe(direction, number, params)
+			catalog.record(direction, number, params, len(operations) > 0)
 			shouldDebug, exists := ConfigGlobal.DebugOperations[int(number)]
 			if (exists && shouldDebug) || (!exists && ConfigGlobal.DebugOperationsString == "") {
-				log.Debugf("OperationResponse: [%v]%v - %v", number, OperationType(number), params)
+				log.Debugf("OperationResponse: [%v]%v - %v", number, operationName(number), params)
 			}
 		} else if !ConfigGlobal.DebugIgnoreDecodingErrors {
 			log.Debugf("OperationResponse: ERROR - %v", params)
 		}
 	case photon.EventDataType:
-		operation, err = decodeEvent(params)
+		direction = directionEvent
+		operations, err = decodeEvent(params)
 		if params[252] != nil {
 			number := params[252].(int16)
+			protocolDrift.observe(direction, number, params)
+			catalog.record(direction, number, params, len(operations) > 0)
 			shouldDebug, exists := ConfigGlobal.DebugEvents[int(number)]
 			if (exists && shouldDebug) || (!exists && ConfigGlobal.DebugEventsString == "") {
-				log.Debugf("EventDataType: [%v]%v - %v", number, EventType(number), params)
+				log.Debugf("EventDataType: [%v]%v - %v", number, eventName(number), params)
 			}
 		} else if !ConfigGlobal.DebugIgnoreDecodingErrors {
 			log.Debugf("EventDataType: ERROR - %v", params)
@@ -266,10 +287,15 @@ func (l *listener) onReliableCommand(command *photon.PhotonCommand) {
 
 	if err != nil && !ConfigGlobal.DebugIgnoreDecodingErrors {
 		log.Debugf("Error while decoding an event or operation: %v - params: %v", err, params)
-		operation = nil
 	}
 
-	if operation != nil {
-		l.router.newOperation <- operation
+	if len(operations) == 0 {
+		return
+	}
+
+	message := decodedMessage{operations: operations, direction: direction}
+	if direction != directionEvent {
+		message.messageID, message.hasMessageID = messageID(params)
 	}
+	session.enqueue(message)
 }
@@ -0,0 +1,99 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ao-data/albiondata-client/photonsynth"
+)
+
+func TestOfflinePcap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.pcap")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := photonsynth.NewPcapWriter(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	characterID := []int8{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	join, err := photonsynth.Reliable(photonsynth.Response(int16(opJoin), map[uint8]interface{}{1: characterID, 2: "Trader", 8: "3005"}), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request, err := photonsynth.Unreliable(photonsynth.Request(int16(opGoldMarketGetAverageInfo), map[uint8]interface{}{255: int16(9)}), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prices := make([]int32, 200)
+	timestamps := make([]int64, 200)
+	for i := range prices {
+		prices[i] = int32(4800 + i)
+		timestamps[i] = 638396640000000000 + int64(i)*36000000000
+	}
+	response, err := photonsynth.Fragmented(photonsynth.Response(int16(opGoldMarketGetAverageInfo), map[uint8]interface{}{0: prices, 1: timestamps, 255: int16(9)}), 3, 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.WriteFromServer(join); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteFromClient(request); err != nil {
+		t.Fatal(err)
+	}
+	// One fragment per packet, like the game sends large responses
+	for _, fragment := range response {
+		if err := w.WriteFromServer(fragment); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	captured := make(chan *GoldPricesCaptured, 10)
+	bus.subscribe("offline pcap test", 10, 0, func(e Event) error {
+		select {
+		case captured <- e.(*GoldPricesCaptured):
+		default:
+		}
+		return nil
+	}, (*GoldPricesCaptured)(nil))
+
+	l := newListener(newRouter())
+	defer l.router.pool.close()
+	l.startOfflinePcap(path)
+
+	key, _ := sessionKey(w.ServerIP.String(), w.ServerPort, w.ClientIP.String(), w.ClientPort)
+	s, ok := l.router.sessions[key]
+	if !ok {
+		t.Fatalf("no session %v, got %v", key, l.router.sessions)
+	}
+	done := make(chan struct{})
+	s.enqueue(feederFlush{done: done})
+	<-done
+
+	state := s.snapshot()
+	if state.CharacterName != "Trader" || state.LocationId != "3005" || state.AODataServerID != 1 {
+		t.Errorf("state after the join is %+v", state)
+	}
+
+	select {
+	case e := <-captured:
+		expected := make([]int, len(prices))
+		for i, price := range prices {
+			expected[i] = int(price)
+		}
+		if !reflect.DeepEqual(e.Prices.Prices, expected) || !reflect.DeepEqual(e.Prices.TimeStamps, timestamps) {
+			t.Errorf("gold prices read back as %+v", e.Prices)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the fragmented gold prices were not captured")
+	}
+}
@@ -0,0 +1,35 @@
+package client
+
+import (
+	"github.com/ao-data/albiondata-client/db"
+	"github.com/ao-data/albiondata-client/lib"
+)
+
+// publishMarketSearch publishes what a market search asked for and how many orders it got, so a search
+// that got fewer orders than it asked for tells us there are no other orders for those items.
+// received is the number of orders in the response, including any that could not be parsed.
+func publishMarketSearch(search *operationAuctionGetOffers, auctionType string, received int, orders []*lib.MarketOrder, state *albionState) {
+
+	record := &db.MarketSearch{
+		LocationID:  state.LocationId,
+		AuctionType: auctionType,
+		Category:    search.Category,
+		SubCategory: search.SubCategory,
+		Quality:     search.Quality,
+		Enchantment: int(search.Enchantment),
+		MaxResults:  int(search.MaxResults),
+		ResultCount: len(orders),
+		Complete:    search.MaxResults > 0 && uint32(received) < search.MaxResults,
+	}
+	for _, id := range search.ItemIds {
+		record.ItemIDs = append(record.ItemIDs, int(id))
+	}
+	for _, order := range orders {
+		record.ResultItemIDs = appendUnique(record.ResultItemIDs, order.ItemID)
+	}
+
+	bus.publish(&MarketSearchCompleted{
+		EventContext: newEventContext(state),
+		Search:       record,
+	})
+}
@@ -0,0 +1,226 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ao-data/albiondata-client/log"
+)
+
+// Samples and distinct param signatures kept per message code.
+const (
+	catalogMaxSamples    = 3
+	catalogMaxSignatures = 50
+)
+
+// messageCatalog counts every operation and event code seen, with the types of their params and a
+// few samples, so new messages worth decoding can be found without debug logging
+type messageCatalog struct {
+	mu      sync.Mutex
+	entries map[messageKey]*catalogEntry
+}
+
+type catalogEntry struct {
+	Direction  string          `json:"direction"`
+	Code       int16           `json:"code"`
+	Name       string          `json:"name"`
+	Handled    bool            `json:"handled"`
+	Count      int             `json:"count"`
+	FirstSeen  time.Time       `json:"first_seen"`
+	LastSeen   time.Time       `json:"last_seen"`
+	Signatures map[string]int  `json:"signatures"`
+	Samples    []catalogSample `json:"samples"`
+
+	// Messages with a signature that did not fit into Signatures anymore
+	OtherSignatures int `json:"other_signatures,omitempty"`
+}
+
+type catalogSample struct {
+	SeenAt time.Time              `json:"seen_at"`
+	Params map[string]interface{} `json:"params"`
+}
+
+var catalog = &messageCatalog{entries: make(map[messageKey]*catalogEntry)}
+
+// record counts a message, handled tells whether any handler decoded it
+func (c *messageCatalog) record(direction messageDirection, code int16, params map[uint8]interface{}, handled bool) {
+	signature := paramSignature(params)
+	now := time.Now().UTC()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := messageKey{direction: direction, code: code}
+	entry, ok := c.entries[key]
+	if !ok {
+		name := operationName(code)
+		if direction == directionEvent {
+			name = eventName(code)
+		}
+		entry = &catalogEntry{
+			Direction:  direction.String(),
+			Code:       code,
+			Name:       name,
+			FirstSeen:  now,
+			Signatures: make(map[string]int),
+		}
+		c.entries[key] = entry
+	}
+
+	entry.Count++
+	entry.LastSeen = now
+	entry.Handled = entry.Handled || handled
+
+	_, known := entry.Signatures[signature]
+	switch {
+	case known || len(entry.Signatures) < catalogMaxSignatures:
+		entry.Signatures[signature]++
+	default:
+		entry.OtherSignatures++
+	}
+
+	// Keep the first messages, and make room for ones that look different
+	if len(entry.Samples) < catalogMaxSamples {
+		entry.Samples = append(entry.Samples, newCatalogSample(now, params))
+	} else if !known {
+		entry.Samples[catalogMaxSamples-1] = newCatalogSample(now, params)
+	}
+}
+
+// paramSignature describes the params of a message by their index and type, e.g. "0:string 1:[]int8"
+func paramSignature(params map[uint8]interface{}) string {
+	indices := make([]int, 0, len(params))
+	for index := range params {
+		indices = append(indices, int(index))
+	}
+	sort.Ints(indices)
+
+	parts := make([]string, 0, len(indices))
+	for _, index := range indices {
+		parts = append(parts, fmt.Sprintf("%d:%T", index, params[uint8(index)]))
+	}
+	return strings.Join(parts, " ")
+}
+
+func newCatalogSample(seenAt time.Time, params map[uint8]interface{}) catalogSample {
+	sample := catalogSample{SeenAt: seenAt, Params: make(map[string]interface{}, len(params))}
+	for index, value := range params {
+		sample.Params[strconv.Itoa(int(index))] = catalogValue(value)
+	}
+	return sample
+}
+
+// catalogValue makes a param encodable as JSON, which photon hashtables are not
+func catalogValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = catalogValue(value)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, value := range v {
+			s[i] = catalogValue(value)
+		}
+		return s
+	default:
+		return v
+	}
+}
+
+// export writes the catalog as JSON, unhandled messages first and the most seen first
+func (c *messageCatalog) export(w io.Writer) error {
+	c.mu.Lock()
+	entries := make([]*catalogEntry, 0, len(c.entries))
+	for _, entry := range c.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Handled != entries[j].Handled {
+			return !entries[i].Handled
+		}
+		return entries[i].Count > entries[j].Count
+	})
+
+	data, err := json.MarshalIndent(struct {
+		ExportedAt time.Time       `json:"exported_at"`
+		Messages   []*catalogEntry `json:"messages"`
+	}{time.Now().UTC(), entries}, "", "  ")
+	c.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// writeFile exports the catalog to a file, replacing it only once the export is complete
+func (c *messageCatalog) writeFile(path string) error {
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	err = c.export(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// saveCatalog writes the catalog to the configured file, if there is one
+func saveCatalog() {
+	if ConfigGlobal.CatalogPath == "" {
+		return
+	}
+	if err := catalog.writeFile(ConfigGlobal.CatalogPath); err != nil {
+		log.Errorf("Could not write message catalog to %v: %v", ConfigGlobal.CatalogPath, err)
+	}
+}
+
+// catalogServed returns whether the local server serves /catalog. The samples hold whatever the game
+// sent, e.g. character names and mails, so they are only served when asked for with -catalog or -debug.
+func catalogServed() bool {
+	return ConfigGlobal.CatalogPath != "" || ConfigGlobal.Debug
+}
+
+// serveCatalog answers only clients on this machine unless the server requires a token
+func serveCatalog(w http.ResponseWriter, r *http.Request) {
+	if ConfigGlobal.ServerToken == "" && !isLoopback(r.RemoteAddr) {
+		http.Error(w, "the catalog is only served to this machine unless server.token is set", http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := catalog.export(w); err != nil {
+		log.Debugf("Error while writing message catalog: %v", err)
+	}
+}
+
+// isLoopback returns whether a remote address of a request is on this machine
+func isLoopback(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
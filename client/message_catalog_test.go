@@ -0,0 +1,154 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParamSignature(t *testing.T) {
+	params := map[uint8]interface{}{
+		10:  []int8{1, 2},
+		0:   "Trader",
+		253: int16(opJoin),
+	}
+	if signature := paramSignature(params); signature != "0:string 10:[]int8 253:int16" {
+		t.Errorf("got signature %q", signature)
+	}
+}
+
+func TestCatalogRecord(t *testing.T) {
+	c := &messageCatalog{entries: make(map[messageKey]*catalogEntry)}
+
+	for i := 0; i < catalogMaxSamples+2; i++ {
+		c.record(directionResponse, int16(opJoin), map[uint8]interface{}{0: "Trader"}, false)
+	}
+	c.record(directionResponse, int16(opJoin), map[uint8]interface{}{0: int64(1)}, true)
+
+	entry := c.entries[messageKey{direction: directionResponse, code: int16(opJoin)}]
+	if entry == nil {
+		t.Fatal("response was not recorded")
+	}
+	if entry.Name != "opJoin" || entry.Direction != "response" {
+		t.Errorf("recorded as %v %v", entry.Direction, entry.Name)
+	}
+	if entry.Count != catalogMaxSamples+3 {
+		t.Errorf("counted %d messages", entry.Count)
+	}
+	if !entry.Handled {
+		t.Error("not handled although a handler decoded one message")
+	}
+	if entry.Signatures["0:string"] != catalogMaxSamples+2 || entry.Signatures["0:int64"] != 1 {
+		t.Errorf("got signatures %v", entry.Signatures)
+	}
+
+	// The sample of the signature seen last took the place of the last sample
+	if len(entry.Samples) != catalogMaxSamples {
+		t.Fatalf("kept %d samples", len(entry.Samples))
+	}
+	if last := entry.Samples[catalogMaxSamples-1].Params["0"]; last != int64(1) {
+		t.Errorf("last sample is %v, wanted the one of the new signature", last)
+	}
+}
+
+func TestCatalogSignatureLimit(t *testing.T) {
+	c := &messageCatalog{entries: make(map[messageKey]*catalogEntry)}
+
+	for i := 0; i < catalogMaxSignatures+5; i++ {
+		c.record(directionEvent, 1, map[uint8]interface{}{uint8(i): "x"}, false)
+	}
+
+	entry := c.entries[messageKey{direction: directionEvent, code: 1}]
+	if len(entry.Signatures) != catalogMaxSignatures || entry.OtherSignatures != 5 {
+		t.Errorf("kept %d signatures and counted %d others", len(entry.Signatures), entry.OtherSignatures)
+	}
+}
+
+func TestCatalogExport(t *testing.T) {
+	c := &messageCatalog{entries: make(map[messageKey]*catalogEntry)}
+	c.record(directionResponse, int16(opJoin), map[uint8]interface{}{0: "Trader"}, true)
+	c.record(directionEvent, 1, map[uint8]interface{}{0: map[interface{}]interface{}{int8(1): []interface{}{"a"}}}, false)
+	c.record(directionEvent, 1, map[uint8]interface{}{}, false)
+
+	var buf bytes.Buffer
+	if err := c.export(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var exported struct {
+		Messages []struct {
+			Code    int16 `json:"code"`
+			Handled bool  `json:"handled"`
+			Samples []struct {
+				Params map[string]interface{} `json:"params"`
+			} `json:"samples"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &exported); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(exported.Messages) != 2 {
+		t.Fatalf("exported %d messages", len(exported.Messages))
+	}
+	if exported.Messages[0].Handled || exported.Messages[1].Code != int16(opJoin) {
+		t.Error("unhandled messages are not exported first")
+	}
+	hashtable, ok := exported.Messages[0].Samples[0].Params["0"].(map[string]interface{})
+	if !ok || hashtable["1"] == nil {
+		t.Errorf("hashtable param exported as %v", exported.Messages[0].Samples[0].Params["0"])
+	}
+}
+
+func TestServeCatalog(t *testing.T) {
+	tests := []struct {
+		name       string
+		remoteAddr string
+		token      string
+		status     int
+	}{
+		{name: "this machine", remoteAddr: "127.0.0.1:50000", status: http.StatusOK},
+		{name: "this machine over ipv6", remoteAddr: "[::1]:50000", status: http.StatusOK},
+		{name: "other machine", remoteAddr: "192.168.1.20:50000", status: http.StatusForbidden},
+		{name: "other machine with a token", remoteAddr: "192.168.1.20:50000", token: "secret", status: http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token := ConfigGlobal.ServerToken
+			ConfigGlobal.ServerToken = test.token
+			t.Cleanup(func() { ConfigGlobal.ServerToken = token })
+
+			req := httptest.NewRequest("GET", "/catalog", nil)
+			req.RemoteAddr = test.remoteAddr
+			rec := httptest.NewRecorder()
+			serveCatalog(rec, req)
+
+			if rec.Code != test.status {
+				t.Errorf("got status %d, wanted %d", rec.Code, test.status)
+			}
+		})
+	}
+}
+
+func TestCatalogServed(t *testing.T) {
+	path, debug := ConfigGlobal.CatalogPath, ConfigGlobal.Debug
+	t.Cleanup(func() { ConfigGlobal.CatalogPath, ConfigGlobal.Debug = path, debug })
+
+	ConfigGlobal.CatalogPath, ConfigGlobal.Debug = "", false
+	if catalogServed() {
+		t.Error("catalog served without -catalog or -debug")
+	}
+
+	ConfigGlobal.CatalogPath = "catalog.json"
+	if !catalogServed() {
+		t.Error("catalog not served with -catalog")
+	}
+
+	ConfigGlobal.CatalogPath, ConfigGlobal.Debug = "", true
+	if !catalogServed() {
+		t.Error("catalog not served with -debug")
+	}
+}
@@ -31,4 +31,6 @@ func processOffline(path string) {
 	} else {
 		log.Error("Only .pcap and .gob files supported at this time.")
 	}
+
+	saveCatalog()
 }
@@ -2,13 +2,16 @@ package client
 
 import (
 	"sort"
-	"time"
 
 	"github.com/ao-data/albiondata-client/lib"
 	"github.com/ao-data/albiondata-client/log"
-	uuid "github.com/nu7hatch/gouuid"
 )
 
+func init() {
+	registerRequest(opAuctionGetItemAverageStats, func() operation { return &operationAuctionGetItemAverageStats{} })
+	registerResponse(opAuctionGetItemAverageStats, func() operation { return &operationAuctionGetItemAverageStatsResponse{} })
+}
+
 type operationAuctionGetItemAverageStats struct {
 	ItemID      int32         `mapstructure:"1"`
 	Quality     uint8         `mapstructure:"2"`
@@ -18,27 +21,19 @@ type operationAuctionGetItemAverageStats struct {
 }
 
 func (op operationAuctionGetItemAverageStats) Process(state *albionState) {
-	var index = op.MessageID % CacheSize
+	log.Debugf("Market History - Requested history of %d for message %d.", op.albionID(), op.MessageID)
+}
 
+// albionID returns the ID of the item, corrected for the IDs that come through negative
+func (op operationAuctionGetItemAverageStats) albionID() int32 {
 	// It seems all items with id 129-256 come through as a negative integer. Example, goose eggs
 	// comes through as -121. (-121)+256=135. As of today (2024-01-07), the itemId in the ao-bin-dumps repo
 	// is 135. This occurs for all items we can search the market for with english text from id 128-256.
 	// Anything 128 and below or 256 and greater seem to work just fine. - phendryx 2024-01-07
-	var itemId = op.ItemID
-	if itemId < 0 && itemId > -129 {
-		itemId = itemId + 256
-	} else {
-		itemId = op.ItemID
+	if op.ItemID < 0 && op.ItemID > -129 {
+		return op.ItemID + 256
 	}
-
-	mhInfo := marketHistoryInfo{
-		albionId:  itemId,
-		timescale: op.Timescale,
-		quality:   op.Quality,
-	}
-
-	state.marketHistoryIDLookup[index] = mhInfo
-	log.Debugf("Market History - Caching %d at %d.", mhInfo.albionId, index)
+	return op.ItemID
 }
 
 type operationAuctionGetItemAverageStatsResponse struct {
@@ -46,33 +41,24 @@ type operationAuctionGetItemAverageStatsResponse struct {
 	SilverAmounts []uint64 `mapstructure:"1"`
 	Timestamps    []uint64 `mapstructure:"2"`
 	MessageID     int      `mapstructure:"255"`
+	responseTo
 }
 
 func (op operationAuctionGetItemAverageStatsResponse) Process(state *albionState) {
-	var index = op.MessageID % CacheSize
-
-	// Wait for the correlating Request if it has not yet been processed
-	waits := 0
-	for waits < 30 {
-		if state.marketHistoryIDLookup[index].albionId < 1 {
-			time.Sleep(1 * time.Second)
-			waits += 1
-		} else {
-			break
-		}
-	}
-
-	// Still no correlating Request has been processed
-	if state.marketHistoryIDLookup[index].albionId < 1 {
-		log.Warnf("Market History - Market history at index %d is invalid. Has albionId: %s ", index, state.marketHistoryIDLookup[index].albionId)
+	// The request was processed before, unless we did not see it or it is too long ago
+	request, ok := op.request.(*operationAuctionGetItemAverageStats)
+	if !ok || request.albionID() < 1 {
+		log.Warnf("Market History - No market history request found for message %d", op.MessageID)
 		return
 	}
 
-	var mhInfo = state.marketHistoryIDLookup[index]
+	mhInfo := marketHistoryInfo{
+		albionId:  request.albionID(),
+		timescale: request.Timescale,
+		quality:   request.Quality,
+	}
 
-	// Clear the index in the cache
-	state.marketHistoryIDLookup[index].albionId = 0
-	log.Debugf("Market History - Loaded itemID %d from cache at index %d", mhInfo.albionId, index)
+	log.Debugf("Market History - Loaded itemID %d from the request of message %d", mhInfo.albionId, op.MessageID)
 	log.Debug("Got response to GetItemAverageStats operation for the itemID[", mhInfo.albionId, "] of quality: ", mhInfo.quality, " and on the timescale: ", mhInfo.timescale)
 
 	if !state.IsValidLocation() {
@@ -120,7 +106,8 @@ func (op operationAuctionGetItemAverageStatsResponse) Process(state *albionState
 		Histories:    histories,
 	}
 
-	identifier, _ := uuid.NewV4()
-	log.Infof("Sending %d market history item average stats to ingest for albionID %d (Identifier: %s)", len(histories), mhInfo.albionId, identifier)
-	sendMsgToPublicUploaders(upload, lib.NatsMarketHistoriesIngest, state, identifier.String())
+	bus.publish(&MarketHistoryCaptured{
+		EventContext: newEventContext(state),
+		History:      upload,
+	})
 }
@@ -4,12 +4,15 @@ import (
 	"encoding/json"
 	"strings"
 
-	"github.com/ao-data/albiondata-client/db"
 	"github.com/ao-data/albiondata-client/lib"
 	"github.com/ao-data/albiondata-client/log"
-	uuid "github.com/nu7hatch/gouuid"
 )
 
+func init() {
+	registerRequest(opAuctionGetOffers, func() operation { return &operationAuctionGetOffers{} })
+	registerResponse(opAuctionGetOffers, func() operation { return &operationAuctionGetOffersResponse{} })
+}
+
 type operationAuctionGetOffers struct {
 	Category         string   `mapstructure:"1"`
 	SubCategory      string   `mapstructure:"2"`
@@ -28,6 +31,7 @@ func (op operationAuctionGetOffers) Process(state *albionState) {
 
 type operationAuctionGetOffersResponse struct {
 	MarketOrders []string `mapstructure:"0"`
+	responseTo
 }
 
 func (op operationAuctionGetOffersResponse) Process(state *albionState) {
@@ -80,26 +84,17 @@ func (op operationAuctionGetOffersResponse) Process(state *albionState) {
 		orders = append(orders, order)
 	}
 
-	if len(orders) < 1 {
-		return
+	if search, ok := op.request.(*operationAuctionGetOffers); ok {
+		publishMarketSearch(search, "offer", len(op.MarketOrders), orders, state)
 	}
 
-	// Save to database if enabled
-	if db.DB != nil {
-		for _, order := range orders {
-			go func(o *lib.MarketOrder) {
-				if err := db.InsertMarketOrder(o); err != nil {
-					log.Debugf("Failed to save market order to database: %v", err)
-				}
-			}(order)
-		}
-	}
-
-	upload := lib.MarketUpload{
-		Orders: orders,
+	if len(orders) < 1 {
+		return
 	}
 
-	identifier, _ := uuid.NewV4()
-	log.Infof("Sending %d live market sell orders to ingest (Identifier: %s)", len(orders), identifier)
-	sendMsgToPublicUploaders(upload, lib.NatsMarketOrdersIngest, state, identifier.String())
+	bus.publish(&MarketOrdersCaptured{
+		EventContext: newEventContext(state),
+		AuctionType:  "offer",
+		Orders:       orders,
+	})
 }
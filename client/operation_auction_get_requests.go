@@ -3,14 +3,26 @@ package client
 import (
 	"encoding/json"
 
-	"github.com/ao-data/albiondata-client/db"
 	"github.com/ao-data/albiondata-client/lib"
 	"github.com/ao-data/albiondata-client/log"
-	uuid "github.com/nu7hatch/gouuid"
 )
 
+func init() {
+	registerRequest(opAuctionGetRequests, func() operation { return &operationAuctionGetRequests{} })
+	registerResponse(opAuctionGetRequests, func() operation { return &operationAuctionGetRequestsResponse{} })
+	registerResponse(opAuctionBuyOffer, func() operation { return &operationAuctionGetRequestsResponse{} })
+}
+
+// operationAuctionGetRequests takes the same parameters as operationAuctionGetOffers
+type operationAuctionGetRequests operationAuctionGetOffers
+
+func (op operationAuctionGetRequests) Process(state *albionState) {
+	log.Debug("Got AuctionGetRequests operation...")
+}
+
 type operationAuctionGetRequestsResponse struct {
 	MarketOrders []string `mapstructure:"0"`
+	responseTo
 }
 
 func (op operationAuctionGetRequestsResponse) Process(state *albionState) {
@@ -34,26 +46,17 @@ func (op operationAuctionGetRequestsResponse) Process(state *albionState) {
 		orders = append(orders, order)
 	}
 
-	if len(orders) < 1 {
-		return
-	}
-
-	// Save to database if enabled
-	if db.DB != nil {
-		for _, order := range orders {
-			go func(o *lib.MarketOrder) {
-				if err := db.InsertMarketOrder(o); err != nil {
-					log.Debugf("Failed to save market order to database: %v", err)
-				}
-			}(order)
-		}
+	if search, ok := op.request.(*operationAuctionGetRequests); ok {
+		publishMarketSearch((*operationAuctionGetOffers)(search), "request", len(op.MarketOrders), orders, state)
 	}
 
-	upload := lib.MarketUpload{
-		Orders: orders,
+	if len(orders) < 1 {
+		return
 	}
 
-	identifier, _ := uuid.NewV4()
-	log.Infof("Sending %d live market buy orders to ingest (Identifier: %s)", len(orders), identifier)
-	sendMsgToPublicUploaders(upload, lib.NatsMarketOrdersIngest, state, identifier.String())
+	bus.publish(&MarketOrdersCaptured{
+		EventContext: newEventContext(state),
+		AuctionType:  "request",
+		Orders:       orders,
+	})
 }
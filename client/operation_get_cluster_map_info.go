@@ -5,9 +5,13 @@ import (
 	"strconv"
 
 	"github.com/ao-data/albiondata-client/log"
-	uuid "github.com/nu7hatch/gouuid"
 )
 
+func init() {
+	registerRequest(opGetClusterMapInfo, func() operation { return &operationGetClusterMapInfo{} })
+	registerResponse(opGetClusterMapInfo, func() operation { return &operationGetClusterMapInfoResponse{} })
+}
+
 type operationGetClusterMapInfo struct {
 }
 
@@ -52,7 +56,8 @@ func (op operationGetClusterMapInfoResponse) Process(state *albionState) {
 		Permission:      op.Permission,
 	}
 
-	identifier, _ := uuid.NewV4()
-	log.Info("Sending map data to ingest (Identifier: %s)", identifier)
-	sendMsgToPublicUploaders(upload, lib.NatsMapDataIngest, state, identifier.String())
+	bus.publish(&MapDataCaptured{
+		EventContext: newEventContext(state),
+		MapData:      upload,
+	})
 }
@@ -4,9 +4,13 @@ import (
 //	"strconv"
 //	"strings"
 
-//	"github.com/ao-data/albiondata-client/log"
+// "github.com/ao-data/albiondata-client/log"
 )
 
+func init() {
+	registerRequest(opGetGameServerByCluster, func() operation { return &operationGetGameServerByCluster{} })
+}
+
 type operationGetGameServerByCluster struct {
 	ZoneID string `mapstructure:"0"`
 }
@@ -7,6 +7,10 @@ import (
 	"github.com/ao-data/albiondata-client/log"
 )
 
+func init() {
+	registerResponse(opGetMailInfos, func() operation { return &operationGetMailInfosResponse{} })
+}
+
 var MailInfos MailInfosLookup
 
 type MailInfosLookup []MailInfo
@@ -64,5 +68,5 @@ func (op operationGetMailInfosResponse) Process(state *albionState) {
 		return
 	}
 
-	log.Infof("Mail Infos - Cached %#d mail infos", len(MailInfos))
+	log.Infof("Mail Infos - Cached %d mail infos", len(MailInfos))
 }
@@ -3,9 +3,13 @@ package client
 import (
 	"github.com/ao-data/albiondata-client/lib"
 	"github.com/ao-data/albiondata-client/log"
-	uuid "github.com/nu7hatch/gouuid"
 )
 
+func init() {
+	registerRequest(opGoldMarketGetAverageInfo, func() operation { return &operationGoldMarketGetAverageInfo{} })
+	registerResponse(opGoldMarketGetAverageInfo, func() operation { return &operationGoldMarketGetAverageInfoResponse{} })
+}
+
 type operationGoldMarketGetAverageInfo struct {
 }
 
@@ -26,7 +30,8 @@ func (op operationGoldMarketGetAverageInfoResponse) Process(state *albionState)
 		TimeStamps: op.TimeStamps,
 	}
 
-	identifier, _ := uuid.NewV4()
-	log.Infof("Sending gold prices to ingest (Identifier: %s)", identifier)
-	sendMsgToPublicUploaders(upload, lib.NatsGoldPricesIngest, state, identifier.String())
+	bus.publish(&GoldPricesCaptured{
+		EventContext: newEventContext(state),
+		Prices:       upload,
+	})
 }
@@ -1,11 +1,14 @@
 package client
 
 import (
-
 	"github.com/ao-data/albiondata-client/lib"
 	"github.com/ao-data/albiondata-client/log"
 )
 
+func init() {
+	registerResponse(opJoin, func() operation { return &operationJoinResponse{} })
+}
+
 type operationJoinResponse struct {
 	CharacterID   lib.CharacterID `mapstructure:"1"`
 	CharacterName string          `mapstructure:"2"`
@@ -20,11 +23,8 @@ type operationJoinResponse struct {
 func (op operationJoinResponse) Process(state *albionState) {
 	log.Debugf("Got JoinResponse operation...")
 
-	// Reset the AODataServerID here. This leads to a fresh execution
-	// of SetServerID() incase the player switched servers
-	state.AODataServerID = 0
-
 	log.Infof("Updating player location to %v.", op.Location)
+	from := state.LocationId
 	state.LocationId = op.Location
 
 	if state.CharacterId != op.CharacterID {
@@ -36,4 +36,9 @@ func (op operationJoinResponse) Process(state *albionState) {
 		log.Infof("Updating player to %v.", op.CharacterName)
 	}
 	state.CharacterName = op.CharacterName
+
+	bus.publish(&CharacterJoined{EventContext: newEventContext(state)})
+	if from != state.LocationId {
+		bus.publish(&LocationChanged{EventContext: newEventContext(state), From: from})
+	}
 }
@@ -0,0 +1,65 @@
+package client
+
+import (
+	"hash/fnv"
+	"runtime"
+)
+
+// Operations a worker can have waiting before the listeners have to wait for it.
+const operationQueueSize = 1000
+
+// operationJob is an operation along with the session it belongs to
+type operationJob struct {
+	session *session
+	op      operation
+}
+
+// operationPool processes operations on a fixed number of workers. All operations of a
+// session go to the same worker, so they are processed in the order they were captured
+// and a response is never processed before its request.
+type operationPool struct {
+	queues []chan operationJob
+}
+
+func newOperationPool(workers int) *operationPool {
+	if workers < 1 {
+		workers = 1
+	}
+
+	p := &operationPool{queues: make([]chan operationJob, workers)}
+	for i := range p.queues {
+		p.queues[i] = make(chan operationJob, operationQueueSize)
+		go p.work(p.queues[i])
+	}
+
+	return p
+}
+
+// defaultOperationWorkers is the number of workers of the router's pool
+func defaultOperationWorkers() int {
+	workers := runtime.NumCPU()
+	if workers < 2 {
+		workers = 2
+	}
+	return workers
+}
+
+// close stops the workers once they processed what is queued. Nothing may be queued afterwards.
+func (p *operationPool) close() {
+	for _, queue := range p.queues {
+		close(queue)
+	}
+}
+
+func (p *operationPool) work(queue chan operationJob) {
+	for job := range queue {
+		job.session.process(job.op)
+	}
+}
+
+// queue returns the queue of the worker processing the operations of a session
+func (p *operationPool) queue(key string) chan operationJob {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return p.queues[h.Sum32()%uint32(len(p.queues))]
+}
@@ -6,9 +6,12 @@ import (
 
 	"github.com/ao-data/albiondata-client/lib"
 	"github.com/ao-data/albiondata-client/log"
-	uuid "github.com/nu7hatch/gouuid"
 )
 
+func init() {
+	registerResponse(opReadMail, func() operation { return &operationReadMail{} })
+}
+
 type operationReadMail struct {
 	ID   int    `mapstructure:"0"`
 	Body string `mapstructure:"1"`
@@ -45,8 +48,10 @@ func (op operationReadMail) Process(state *albionState) {
 		Notification: notification,
 	}
 
-	identifier, _ := uuid.NewV4()
-	sendMsgToPrivateUploaders(&upload, lib.NatsMarketNotifications, state, identifier.String())
+	bus.publish(&MarketNotificationCaptured{
+		EventContext: newEventContext(state),
+		Notification: upload,
+	})
 }
 
 func decodeSellNotification(op operationReadMail, body []string) lib.MarketNotification {
@@ -4,6 +4,11 @@ import (
 	"github.com/ao-data/albiondata-client/log"
 )
 
+func init() {
+	registerRequest(opRealEstateBidOnAuction, func() operation { return &operationRealEstateBidOnAuction{} })
+	registerResponse(opRealEstateBidOnAuction, func() operation { return &operationRealEstateBidOnAuctionResponse{} })
+}
+
 type operationRealEstateBidOnAuction struct {
 }
 
@@ -4,6 +4,11 @@ import (
 	"github.com/ao-data/albiondata-client/log"
 )
 
+func init() {
+	registerRequest(opRealEstateGetAuctionData, func() operation { return &operationRealEstateGetAuctionData{} })
+	registerResponse(opRealEstateGetAuctionData, func() operation { return &operationRealEstateGetAuctionDataResponse{} })
+}
+
 type operationRealEstateGetAuctionData struct {
 	PlotID int `mapstructure:"0"`
 }
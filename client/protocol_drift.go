@@ -0,0 +1,252 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ao-data/albiondata-client/log"
+	"github.com/ao-data/albiondata-client/notification"
+)
+
+// Mismatches of a signature before we warn about protocol drift.
+const driftThreshold = 3
+
+// signatureResult is whether a message looks like a signature says it should
+type signatureResult int
+
+const (
+	signatureUnknown signatureResult = iota
+	signatureMatch
+	signatureMismatch
+)
+
+// messageSignature describes what a message with a known code looks like, so we notice when
+// a game patch shifted the codes in operations.go or events.go
+type messageSignature struct {
+	name      string
+	direction messageDirection
+	code      int16
+	check     func(params map[uint8]interface{}) signatureResult
+}
+
+var messageSignatures = []*messageSignature{
+	{name: "opJoin", direction: directionResponse, code: int16(opJoin), check: checkJoinResponse},
+	{name: "opAuctionGetOffers", direction: directionResponse, code: int16(opAuctionGetOffers), check: checkMarketOrdersResponse},
+	{name: "opAuctionGetRequests", direction: directionResponse, code: int16(opAuctionGetRequests), check: checkMarketOrdersResponse},
+	{name: "opAuctionGetItemAverageStats", direction: directionResponse, code: int16(opAuctionGetItemAverageStats), check: checkItemAverageStatsResponse},
+}
+
+// checkJoinResponse expects the character ID at param 1, the character name at param 2 and the location at param 8
+func checkJoinResponse(params map[uint8]interface{}) signatureResult {
+	id, isID := params[1].([]int8)
+	_, isName := params[2].(string)
+	_, isLocation := params[8].(string)
+	if isID && len(id) == 16 && isName && isLocation {
+		return signatureMatch
+	}
+	return signatureMismatch
+}
+
+// checkMarketOrdersResponse expects the orders as JSON strings with an ItemTypeId at param 0
+func checkMarketOrdersResponse(params map[uint8]interface{}) signatureResult {
+	orders, ok := params[0].([]string)
+	if !ok {
+		if params[0] == nil {
+			// No orders at all
+			return signatureUnknown
+		}
+		return signatureMismatch
+	}
+	if len(orders) == 0 {
+		return signatureUnknown
+	}
+
+	var order map[string]interface{}
+	if err := json.Unmarshal([]byte(orders[0]), &order); err != nil {
+		return signatureMismatch
+	}
+	if _, ok := order["ItemTypeId"].(string); !ok {
+		return signatureMismatch
+	}
+	return signatureMatch
+}
+
+// .NET ticks (100ns since 0001-01-01) at the Unix epoch, the market history timestamps come as ticks
+const unixEpochTicks = 621355968000000000
+
+// How far back market history reaches, the weeks view goes back a few months
+const historyMaxAge = 180 * 24 * time.Hour
+
+// checkItemAverageStatsResponse expects item amounts, silver amounts and timestamps of the same length at params 0, 1 and 2.
+// Many messages are three int arrays of the same length, so the values have to look like market history as well: some
+// silver for a nonzero amount of items, at distinct whole hours within the last few months. The timestamps are not
+// sent in order (see lib.MarketHistory).
+func checkItemAverageStatsResponse(params map[uint8]interface{}) signatureResult {
+	if params[0] == nil && params[1] == nil && params[2] == nil {
+		return signatureUnknown
+	}
+
+	amounts, ok := intValues(params[0])
+	if !ok {
+		return signatureMismatch
+	}
+	silver, ok := intValues(params[1])
+	if !ok {
+		return signatureMismatch
+	}
+	timestamps, ok := intValues(params[2])
+	if !ok {
+		return signatureMismatch
+	}
+
+	if len(amounts) != len(silver) || len(silver) != len(timestamps) {
+		return signatureMismatch
+	}
+	if len(amounts) == 0 {
+		return signatureUnknown
+	}
+
+	// Compared in ticks, a timestamp that isn't one could overflow as a time.Time
+	newest := time.Now().Add(time.Hour).UnixNano() / 100
+	oldest := time.Now().Add(-historyMaxAge).UnixNano() / 100
+	seen := make(map[int64]bool, len(timestamps))
+	for i := range amounts {
+		// Amounts of 129 to 255 come through negative, see operationAuctionGetItemAverageStatsResponse
+		if amounts[i] == 0 || amounts[i] < -128 || silver[i] <= 0 {
+			return signatureMismatch
+		}
+
+		ticks := timestamps[i] - unixEpochTicks
+		if ticks < oldest || ticks > newest || ticks%int64(time.Hour/100) != 0 || seen[ticks] {
+			return signatureMismatch
+		}
+		seen[ticks] = true
+	}
+	return signatureMatch
+}
+
+// intValues returns the values of an int array param of any size
+func intValues(param interface{}) ([]int64, bool) {
+	var values []int64
+	switch param := param.(type) {
+	case []int8:
+		for _, v := range param {
+			values = append(values, int64(v))
+		}
+	case []int16:
+		for _, v := range param {
+			values = append(values, int64(v))
+		}
+	case []int32:
+		for _, v := range param {
+			values = append(values, int64(v))
+		}
+	case []int64:
+		values = param
+	default:
+		return nil, false
+	}
+	return values, true
+}
+
+// signatureStats is what was observed for a signature
+type signatureStats struct {
+	matches    int
+	mismatches int
+	warned     bool
+	suggested  bool
+	// Codes of other messages that look like the signature, with how often they did
+	candidates map[int16]int
+}
+
+// driftDetector checks the observed messages against the known signatures
+type driftDetector struct {
+	mu    sync.Mutex
+	stats map[*messageSignature]*signatureStats
+}
+
+var protocolDrift = &driftDetector{stats: make(map[*messageSignature]*signatureStats)}
+
+// observe checks a message against the signatures, warning once a signature mismatched a few times
+// without ever matching
+func (d *driftDetector) observe(direction messageDirection, code int16, params map[uint8]interface{}) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, sig := range messageSignatures {
+		if sig.direction != direction {
+			continue
+		}
+
+		result := sig.check(params)
+		if result == signatureUnknown {
+			continue
+		}
+
+		stats, ok := d.stats[sig]
+		if !ok {
+			stats = &signatureStats{candidates: make(map[int16]int)}
+			d.stats[sig] = stats
+		}
+
+		if code != sig.code {
+			if result == signatureMatch {
+				stats.candidates[code]++
+				// The warning came before we saw what the messages look like now
+				if stats.warned && !stats.suggested && stats.candidates[code] >= driftThreshold {
+					stats.suggested = true
+					log.Error("Protocol drift: " + stats.suggestion(sig))
+				}
+			}
+			continue
+		}
+
+		if result == signatureMatch {
+			stats.matches++
+			continue
+		}
+
+		stats.mismatches++
+		if !stats.warned && stats.matches == 0 && stats.mismatches >= driftThreshold {
+			stats.warned = true
+			d.warn(sig, stats)
+		}
+	}
+}
+
+func (d *driftDetector) warn(sig *messageSignature, stats *signatureStats) {
+	msg := fmt.Sprintf("Protocol drift: %d %v %ss with code %d did not look like %v. The game was probably updated and the codes in this client are out of date.",
+		stats.mismatches, sig.name, sig.direction, sig.code, sig.name)
+	if suggestion := stats.suggestion(sig); suggestion != "" {
+		stats.suggested = true
+		msg += " " + suggestion
+	}
+
+	log.Error(msg)
+	if !ConfigGlobal.Debug {
+		notification.Push("The game seems to have been updated and market data can't be read anymore. Please update the Albion Data Client.")
+	}
+}
+
+// suggestion returns the codes the messages looking like the signature came with, most seen first
+func (s *signatureStats) suggestion(sig *messageSignature) string {
+	if len(s.candidates) == 0 {
+		return ""
+	}
+
+	codes := make([]int16, 0, len(s.candidates))
+	for code := range s.candidates {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool { return s.candidates[codes[i]] > s.candidates[codes[j]] })
+
+	var parts []string
+	for _, code := range codes {
+		parts = append(parts, fmt.Sprintf("%d (offset %+d, seen %d times)", code, int(code)-int(sig.code), s.candidates[code]))
+	}
+	return fmt.Sprintf("Messages that look like %v came with code %v.", sig.name, strings.Join(parts, ", "))
+}
@@ -0,0 +1,264 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+// historyTicks returns a market history timestamp some hours ago
+func historyTicks(hoursAgo int) int64 {
+	at := time.Now().Truncate(time.Hour).Add(-time.Duration(hoursAgo) * time.Hour)
+	return at.UnixNano()/100 + unixEpochTicks
+}
+
+func TestCheckItemAverageStatsResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		params   map[uint8]interface{}
+		expected signatureResult
+	}{
+		{
+			name: "market history",
+			params: map[uint8]interface{}{
+				0: []int8{3, -120, 1},
+				1: []int32{150000, 2400000, 51000},
+				2: []int64{historyTicks(2), historyTicks(0), historyTicks(1)},
+			},
+			expected: signatureMatch,
+		},
+		{
+			name: "weeks of market history",
+			params: map[uint8]interface{}{
+				0: []int16{1200, 980},
+				1: []int64{12000000000, 9500000000},
+				2: []int64{historyTicks(24 * 7 * 10), historyTicks(24 * 7 * 11)},
+			},
+			expected: signatureMatch,
+		},
+		{
+			name:     "no history",
+			params:   map[uint8]interface{}{},
+			expected: signatureUnknown,
+		},
+		{
+			name:     "empty history",
+			params:   map[uint8]interface{}{0: []int8{}, 1: []int8{}, 2: []int8{}},
+			expected: signatureUnknown,
+		},
+		{
+			name:     "arrays of another operation",
+			params:   map[uint8]interface{}{0: []int8{1, 2, 3}, 1: []int16{400, 500, 600}, 2: []int32{7, 8, 9}},
+			expected: signatureMismatch,
+		},
+		{
+			name:     "different lengths",
+			params:   map[uint8]interface{}{0: []int8{1, 2}, 1: []int32{150000}, 2: []int64{historyTicks(0)}},
+			expected: signatureMismatch,
+		},
+		{
+			name:     "not an array",
+			params:   map[uint8]interface{}{0: "Trader", 1: []int32{150000}, 2: []int64{historyTicks(0)}},
+			expected: signatureMismatch,
+		},
+		{
+			name:     "no silver",
+			params:   map[uint8]interface{}{0: []int8{1}, 1: []int32{0}, 2: []int64{historyTicks(0)}},
+			expected: signatureMismatch,
+		},
+		{
+			name:     "no items",
+			params:   map[uint8]interface{}{0: []int8{0}, 1: []int32{150000}, 2: []int64{historyTicks(0)}},
+			expected: signatureMismatch,
+		},
+		{
+			name:     "item amount out of range",
+			params:   map[uint8]interface{}{0: []int16{-300}, 1: []int32{150000}, 2: []int64{historyTicks(0)}},
+			expected: signatureMismatch,
+		},
+		{
+			name:     "timestamp too long ago",
+			params:   map[uint8]interface{}{0: []int8{1}, 1: []int32{150000}, 2: []int64{historyTicks(24 * 365)}},
+			expected: signatureMismatch,
+		},
+		{
+			name:     "timestamp in the future",
+			params:   map[uint8]interface{}{0: []int8{1}, 1: []int32{150000}, 2: []int64{historyTicks(-48)}},
+			expected: signatureMismatch,
+		},
+		{
+			name:     "timestamp not on the hour",
+			params:   map[uint8]interface{}{0: []int8{1}, 1: []int32{150000}, 2: []int64{historyTicks(1) + 1}},
+			expected: signatureMismatch,
+		},
+		{
+			name:     "timestamp twice",
+			params:   map[uint8]interface{}{0: []int8{1, 2}, 1: []int32{150000, 1000}, 2: []int64{historyTicks(1), historyTicks(1)}},
+			expected: signatureMismatch,
+		},
+		{
+			name:     "unix timestamps",
+			params:   map[uint8]interface{}{0: []int8{1}, 1: []int32{150000}, 2: []int64{time.Now().Truncate(time.Hour).Unix()}},
+			expected: signatureMismatch,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := checkItemAverageStatsResponse(test.params); result != test.expected {
+				t.Errorf("got %v, wanted %v", result, test.expected)
+			}
+		})
+	}
+}
+
+// joinResponse returns the params of an opJoin response, or of a response that does not look like one
+func joinResponse(looksLikeJoin bool) map[uint8]interface{} {
+	if !looksLikeJoin {
+		return map[uint8]interface{}{1: int16(3), 2: int32(5)}
+	}
+	return map[uint8]interface{}{1: make([]int8, 16), 2: "Trader", 8: "3005"}
+}
+
+// newTestDrift returns a detector of its own, that does not push notifications
+func newTestDrift(t *testing.T) (*driftDetector, *logtest.Hook) {
+	debug := ConfigGlobal.Debug
+	ConfigGlobal.Debug = true
+	t.Cleanup(func() { ConfigGlobal.Debug = debug })
+
+	return &driftDetector{stats: make(map[*messageSignature]*signatureStats)}, captureWarnings(t)
+}
+
+// driftErrors returns the errors logged about protocol drift
+func driftErrors(hook *logtest.Hook) []string {
+	var messages []string
+	for _, entry := range hook.AllEntries() {
+		if entry.Level == logrus.ErrorLevel {
+			messages = append(messages, entry.Message)
+		}
+	}
+	return messages
+}
+
+func TestDriftWarnsAfterThreshold(t *testing.T) {
+	d, hook := newTestDrift(t)
+	join := messageSignatures[0]
+
+	for i := 0; i < driftThreshold-1; i++ {
+		d.observe(directionResponse, join.code, joinResponse(false))
+	}
+	if stats := d.stats[join]; stats == nil || stats.mismatches != driftThreshold-1 || stats.matches != 0 {
+		t.Fatalf("counted %+v, wanted %d mismatches", stats, driftThreshold-1)
+	}
+	if errors := driftErrors(hook); len(errors) != 0 {
+		t.Fatalf("warned before the threshold: %v", errors)
+	}
+
+	// Other requests and events with the code don't count
+	d.observe(directionRequest, join.code, joinResponse(false))
+	d.observe(directionEvent, join.code, joinResponse(false))
+	if errors := driftErrors(hook); len(errors) != 0 {
+		t.Fatalf("warned about other messages: %v", errors)
+	}
+
+	for i := 0; i < driftThreshold; i++ {
+		d.observe(directionResponse, join.code, joinResponse(false))
+	}
+
+	errors := driftErrors(hook)
+	if len(errors) != 1 {
+		t.Fatalf("warned %d times, wanted once: %v", len(errors), errors)
+	}
+	expected := "Protocol drift: 3 opJoin responses with code 2 did not look like opJoin. The game was probably updated and the codes in this client are out of date."
+	if errors[0] != expected {
+		t.Errorf("warned %q, wanted %q", errors[0], expected)
+	}
+	if stats := d.stats[join]; stats.mismatches != 2*driftThreshold-1 {
+		t.Errorf("counted %d mismatches, wanted %d", stats.mismatches, 2*driftThreshold-1)
+	}
+}
+
+func TestDriftNoWarningAfterMatch(t *testing.T) {
+	d, hook := newTestDrift(t)
+	join := messageSignatures[0]
+
+	d.observe(directionResponse, join.code, joinResponse(true))
+	for i := 0; i < 2*driftThreshold; i++ {
+		d.observe(directionResponse, join.code, joinResponse(false))
+	}
+
+	if errors := driftErrors(hook); len(errors) != 0 {
+		t.Errorf("warned although the code matched before: %v", errors)
+	}
+	if stats := d.stats[join]; stats.matches != 1 || stats.mismatches != 2*driftThreshold {
+		t.Errorf("counted %+v", stats)
+	}
+}
+
+func TestDriftSuggestsCodes(t *testing.T) {
+	d, hook := newTestDrift(t)
+	join := messageSignatures[0]
+
+	for i := 0; i < driftThreshold; i++ {
+		d.observe(directionResponse, 1000, joinResponse(true))
+	}
+	d.observe(directionResponse, 1001, joinResponse(true))
+	// Messages with other codes that don't look like the signature are no candidates
+	d.observe(directionResponse, 1002, joinResponse(false))
+
+	for i := 0; i < driftThreshold; i++ {
+		d.observe(directionResponse, join.code, joinResponse(false))
+	}
+
+	errors := driftErrors(hook)
+	if len(errors) != 1 {
+		t.Fatalf("warned %d times, wanted once: %v", len(errors), errors)
+	}
+	expected := "Protocol drift: 3 opJoin responses with code 2 did not look like opJoin. The game was probably updated and the codes in this client are out of date." +
+		" Messages that look like opJoin came with code 1000 (offset +998, seen 3 times), 1001 (offset +999, seen 1 times)."
+	if errors[0] != expected {
+		t.Errorf("warned %q, wanted %q", errors[0], expected)
+	}
+
+	// The suggestion came with the warning
+	for i := 0; i < driftThreshold; i++ {
+		d.observe(directionResponse, 1003, joinResponse(true))
+	}
+	if errors := driftErrors(hook); len(errors) != 1 {
+		t.Errorf("suggested again: %v", errors[1:])
+	}
+}
+
+func TestDriftSuggestsCodesAfterWarning(t *testing.T) {
+	d, hook := newTestDrift(t)
+	join := messageSignatures[0]
+
+	for i := 0; i < driftThreshold; i++ {
+		d.observe(directionResponse, join.code, joinResponse(false))
+	}
+	if errors := driftErrors(hook); len(errors) != 1 {
+		t.Fatalf("warned %d times, wanted once: %v", len(errors), errors)
+	}
+
+	for i := 0; i < driftThreshold-1; i++ {
+		d.observe(directionResponse, 1000, joinResponse(true))
+	}
+	if errors := driftErrors(hook); len(errors) != 1 {
+		t.Fatalf("suggested a code seen less than %d times: %v", driftThreshold, errors[1:])
+	}
+
+	for i := 0; i < driftThreshold; i++ {
+		d.observe(directionResponse, 1000, joinResponse(true))
+	}
+
+	errors := driftErrors(hook)
+	if len(errors) != 2 {
+		t.Fatalf("logged %d errors, wanted the warning and one suggestion: %v", len(errors), errors)
+	}
+	expected := "Protocol drift: Messages that look like opJoin came with code 1000 (offset +998, seen 3 times)."
+	if errors[1] != expected {
+		t.Errorf("suggested %q, wanted %q", errors[1], expected)
+	}
+}
@@ -0,0 +1,187 @@
+package client
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+
+	"github.com/ao-data/albiondata-client/log"
+	"gopkg.in/yaml.v2"
+)
+
+// protocolMapping overrides the codes compiled into operations.go and events.go and the param
+// indices of the mapstructure tags, so a game update can be followed without a new release, e.g.
+//
+//	operations:
+//	  opJoin: 3
+//	  opAuctionGetOffers: 77
+//	events:
+//	  evCharacterStats: 144
+//	params:
+//	  operationJoinResponse:
+//	    CharacterName: 3
+//
+// Operations and events are given by their name in the code tables, params by the name of the
+// struct a message is decoded into and of its field. JSON works as well, as YAML reads it.
+type protocolMapping struct {
+	Operations map[string]int16            `yaml:"operations"`
+	Events     map[string]int16            `yaml:"events"`
+	Params     map[string]map[string]uint8 `yaml:"params"`
+}
+
+// paramOverrides maps the mapstructure tag of a field to the param it is to be decoded from
+// instead, per type messages are decoded into
+var paramOverrides = make(map[reflect.Type]map[string]uint8)
+
+// operationNames and eventNames hold the names of the codes that were moved by the mapping
+var operationNames = make(map[int16]string)
+var eventNames = make(map[int16]string)
+
+// loadProtocolMapping reads the mapping from a JSON or YAML file and applies it to the registered
+// handlers. It has to be called before any message is decoded.
+func loadProtocolMapping(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var mapping protocolMapping
+	if err := yaml.UnmarshalStrict(data, &mapping); err != nil {
+		return fmt.Errorf("could not parse %v: %v", path, err)
+	}
+
+	codes := make(map[messageKey]int16)
+	for name, code := range mapping.Operations {
+		op, ok := operationByName(name)
+		if !ok {
+			return fmt.Errorf("unknown operation %v", name)
+		}
+		codes[messageKey{direction: directionRequest, code: int16(op)}] = code
+		codes[messageKey{direction: directionResponse, code: int16(op)}] = code
+	}
+	for name, code := range mapping.Events {
+		ev, ok := eventByName(name)
+		if !ok {
+			return fmt.Errorf("unknown event %v", name)
+		}
+		codes[messageKey{direction: directionEvent, code: int16(ev)}] = code
+	}
+
+	params, err := resolveParamOverrides(mapping.Params)
+	if err != nil {
+		return err
+	}
+
+	remapHandlers(codes)
+	paramOverrides = params
+
+	for name, code := range mapping.Operations {
+		operationNames[code] = name
+		for _, sig := range messageSignatures {
+			if sig.name == name {
+				sig.code = code
+			}
+		}
+	}
+	for name, code := range mapping.Events {
+		eventNames[code] = name
+	}
+
+	log.Infof("Loaded protocol mapping from %v: %d operations, %d events and the params of %d messages",
+		path, len(mapping.Operations), len(mapping.Events), len(mapping.Params))
+	return nil
+}
+
+// remapHandlers moves the handlers registered for the built-in codes to the ones of the mapping
+func remapHandlers(codes map[messageKey]int16) {
+	remapped := make(map[messageKey][]operationFactory)
+	moved := make(map[messageKey]bool)
+	for key, factories := range messageHandlers {
+		if code, ok := codes[key]; ok {
+			key.code = code
+			moved[key] = true
+		}
+		remapped[key] = append(remapped[key], factories...)
+	}
+
+	for key := range moved {
+		if _, ok := codes[key]; ok {
+			// The handlers there were moved away as well
+			continue
+		}
+		if _, shared := messageHandlers[key]; shared {
+			log.Warnf("Protocol mapping moved a %v to code %d, which still has the handlers of the built-in code as well", key.direction, key.code)
+		}
+	}
+
+	messageHandlers = remapped
+}
+
+// resolveParamOverrides turns the struct and field names of the mapping into the types and tags decodeParams works with
+func resolveParamOverrides(params map[string]map[string]uint8) (map[reflect.Type]map[string]uint8, error) {
+	types := make(map[string]reflect.Type)
+	for _, factories := range messageHandlers {
+		for _, factory := range factories {
+			t := reflect.TypeOf(factory())
+			types[t.Elem().Name()] = t
+		}
+	}
+
+	overrides := make(map[reflect.Type]map[string]uint8)
+	for typeName, fields := range params {
+		t, ok := types[typeName]
+		if !ok {
+			return nil, fmt.Errorf("no message is decoded into %v", typeName)
+		}
+
+		overrides[t] = make(map[string]uint8)
+		for fieldName, index := range fields {
+			field, ok := t.Elem().FieldByName(fieldName)
+			if !ok {
+				return nil, fmt.Errorf("%v has no field %v", typeName, fieldName)
+			}
+			tag := field.Tag.Get("mapstructure")
+			if tag == "" || tag == "-" {
+				return nil, fmt.Errorf("%v.%v is not decoded from a param", typeName, fieldName)
+			}
+			overrides[t][tag] = index
+		}
+	}
+
+	return overrides, nil
+}
+
+func operationByName(name string) (OperationType, bool) {
+	for op := OperationType(0); !strings.HasPrefix(op.String(), "OperationType("); op++ {
+		if op.String() == name {
+			return op, true
+		}
+	}
+	return 0, false
+}
+
+func eventByName(name string) (EventType, bool) {
+	for ev := EventType(0); !strings.HasPrefix(ev.String(), "EventType("); ev++ {
+		if ev.String() == name {
+			return ev, true
+		}
+	}
+	return 0, false
+}
+
+// operationName returns the name of an operation code, taking the protocol mapping into account
+func operationName(code int16) string {
+	if name, ok := operationNames[code]; ok {
+		return name
+	}
+	return OperationType(code).String()
+}
+
+// eventName returns the name of an event code, taking the protocol mapping into account
+func eventName(code int16) string {
+	if name, ok := eventNames[code]; ok {
+		return name
+	}
+	return EventType(code).String()
+}
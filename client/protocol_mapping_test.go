@@ -0,0 +1,306 @@
+package client
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+// keepProtocol restores the handlers, param overrides and names a test changes
+func keepProtocol(t *testing.T) {
+	handlers := make(map[messageKey][]operationFactory)
+	for key, factories := range messageHandlers {
+		handlers[key] = factories
+	}
+	overrides := paramOverrides
+	operations := make(map[int16]string)
+	for code, name := range operationNames {
+		operations[code] = name
+	}
+	events := make(map[int16]string)
+	for code, name := range eventNames {
+		events[code] = name
+	}
+	codes := make([]int16, len(messageSignatures))
+	for i, sig := range messageSignatures {
+		codes[i] = sig.code
+	}
+
+	t.Cleanup(func() {
+		messageHandlers = handlers
+		paramOverrides = overrides
+		operationNames = operations
+		eventNames = events
+		for i, sig := range messageSignatures {
+			sig.code = codes[i]
+		}
+	})
+}
+
+// captureWarnings returns a hook that collects what is logged while the test runs
+func captureWarnings(t *testing.T) *logtest.Hook {
+	hook := &logtest.Hook{}
+	hooks := logrus.StandardLogger().ReplaceHooks(logrus.LevelHooks{})
+	logrus.AddHook(hook)
+	t.Cleanup(func() { logrus.StandardLogger().ReplaceHooks(hooks) })
+	return hook
+}
+
+// handlerTypes returns the names of the types a message is decoded into
+func handlerTypes(direction messageDirection, code int16) []string {
+	var names []string
+	for _, factory := range messageHandlers[messageKey{direction: direction, code: code}] {
+		names = append(names, reflect.TypeOf(factory()).Elem().Name())
+	}
+	return names
+}
+
+func TestRemapHandlers(t *testing.T) {
+	join := messageKey{direction: directionResponse, code: int16(opJoin)}
+	offers := messageKey{direction: directionResponse, code: int16(opAuctionGetOffers)}
+
+	tests := []struct {
+		name     string
+		codes    map[messageKey]int16
+		expected map[int16][]string
+		warns    bool
+	}{
+		{
+			name:  "moved to a free code",
+			codes: map[messageKey]int16{join: 1000},
+			expected: map[int16][]string{
+				1000:                      {"operationJoinResponse"},
+				int16(opJoin):             nil,
+				int16(opAuctionGetOffers): {"operationAuctionGetOffersResponse"},
+			},
+		},
+		{
+			name:  "moved onto the code of another message",
+			codes: map[messageKey]int16{join: int16(opAuctionGetOffers)},
+			expected: map[int16][]string{
+				int16(opJoin):             nil,
+				int16(opAuctionGetOffers): {"operationAuctionGetOffersResponse", "operationJoinResponse"},
+			},
+			warns: true,
+		},
+		{
+			name:  "swapped with another message",
+			codes: map[messageKey]int16{join: int16(opAuctionGetOffers), offers: int16(opJoin)},
+			expected: map[int16][]string{
+				int16(opJoin):             {"operationAuctionGetOffersResponse"},
+				int16(opAuctionGetOffers): {"operationJoinResponse"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			keepProtocol(t)
+			hook := captureWarnings(t)
+
+			remapHandlers(test.codes)
+
+			for code, expected := range test.expected {
+				// Handlers merged onto a code come in map order
+				actual := handlerTypes(directionResponse, code)
+				sort.Strings(actual)
+				if !reflect.DeepEqual(actual, expected) {
+					t.Errorf("response %d is decoded into %v, wanted %v", code, actual, expected)
+				}
+			}
+
+			warned := false
+			for _, entry := range hook.AllEntries() {
+				if entry.Level == logrus.WarnLevel && strings.Contains(entry.Message, "still has the handlers") {
+					warned = true
+				}
+			}
+			if warned != test.warns {
+				t.Errorf("warned about a collision: %v, wanted %v", warned, test.warns)
+			}
+		})
+	}
+}
+
+func TestResolveParamOverrides(t *testing.T) {
+	joinType := reflect.TypeOf(&operationJoinResponse{})
+
+	tests := []struct {
+		name     string
+		params   map[string]map[string]uint8
+		expected map[string]uint8
+		err      string
+	}{
+		{
+			name:     "moved param",
+			params:   map[string]map[string]uint8{"operationJoinResponse": {"CharacterName": 3, "Location": 9}},
+			expected: map[string]uint8{"2": 3, "8": 9},
+		},
+		{
+			name:   "unknown struct",
+			params: map[string]map[string]uint8{"operationNoSuchResponse": {"CharacterName": 3}},
+			err:    "no message is decoded into operationNoSuchResponse",
+		},
+		{
+			name:   "unknown field",
+			params: map[string]map[string]uint8{"operationJoinResponse": {"NoSuchField": 3}},
+			err:    "operationJoinResponse has no field NoSuchField",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			overrides, err := resolveParamOverrides(test.params)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("got error %v, wanted %v", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(overrides[joinType], test.expected) {
+				t.Errorf("got overrides %v, wanted %v", overrides[joinType], test.expected)
+			}
+		})
+	}
+}
+
+func TestDecodeMovedParam(t *testing.T) {
+	keepProtocol(t)
+
+	overrides, err := resolveParamOverrides(map[string]map[string]uint8{
+		"operationJoinResponse": {"CharacterName": 3, "Location": 9},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	paramOverrides = overrides
+
+	params := map[uint8]interface{}{
+		2:   "old index",
+		3:   "Trader",
+		8:   "old index",
+		253: int16(opJoin),
+	}
+	operations, err := decodeResponse(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(operations) != 1 {
+		t.Fatalf("decoded into %d operations", len(operations))
+	}
+
+	join := operations[0].(*operationJoinResponse)
+	if join.CharacterName != "Trader" {
+		t.Errorf("CharacterName is %q, wanted it from param 3", join.CharacterName)
+	}
+	if join.Location != "" {
+		t.Errorf("Location is %q, wanted it empty as param 9 is missing", join.Location)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	params := map[uint8]interface{}{
+		2:   int32(5),
+		8:   "3005",
+		253: int16(opJoin),
+	}
+
+	for _, ignore := range []bool{false, true} {
+		ignoring := ConfigGlobal.DebugIgnoreDecodingErrors
+		ConfigGlobal.DebugIgnoreDecodingErrors = ignore
+
+		operations, err := decodeResponse(params)
+		ConfigGlobal.DebugIgnoreDecodingErrors = ignoring
+
+		if err == nil {
+			t.Errorf("ignoring errors %v: decoded a number as CharacterName", ignore)
+		}
+		if !ignore {
+			if len(operations) != 0 {
+				t.Errorf("handed %v to the handlers although it did not decode", operations)
+			}
+			continue
+		}
+
+		// The handlers get what could be decoded, like before handlers were registered
+		if len(operations) != 1 {
+			t.Fatalf("ignoring errors: decoded into %d operations", len(operations))
+		}
+		if join := operations[0].(*operationJoinResponse); join.Location != "3005" {
+			t.Errorf("ignoring errors: Location is %q", join.Location)
+		}
+	}
+}
+
+func TestLoadProtocolMapping(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping string
+		err     string
+	}{
+		{
+			name:    "moved operation and param",
+			mapping: "operations:\n  opJoin: 1000\nparams:\n  operationJoinResponse:\n    CharacterName: 3\n",
+		},
+		{
+			name:    "unknown operation",
+			mapping: "operations:\n  opNoSuchThing: 1000\n",
+			err:     "unknown operation opNoSuchThing",
+		},
+		{
+			name:    "unknown event",
+			mapping: "events:\n  evNoSuchThing: 1000\n",
+			err:     "unknown event evNoSuchThing",
+		},
+		{
+			name:    "unknown field",
+			mapping: "params:\n  operationJoinResponse:\n    NoSuchField: 3\n",
+			err:     "operationJoinResponse has no field NoSuchField",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			keepProtocol(t)
+
+			path := filepath.Join(t.TempDir(), "protocol-mapping.yaml")
+			if err := ioutil.WriteFile(path, []byte(test.mapping), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			err := loadProtocolMapping(path)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("got error %v, wanted %v", err, test.err)
+				}
+				if types := handlerTypes(directionResponse, int16(opJoin)); len(types) != 1 {
+					t.Errorf("a mapping that failed to load moved the handlers, opJoin is decoded into %v", types)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if name := operationName(1000); name != "opJoin" {
+				t.Errorf("code 1000 is named %v", name)
+			}
+			operations, err := decodeResponse(map[uint8]interface{}{3: "Trader", 253: int16(1000)})
+			if err != nil || len(operations) != 1 {
+				t.Fatalf("moved response decoded into %v, %v", operations, err)
+			}
+			if join := operations[0].(*operationJoinResponse); join.CharacterName != "Trader" {
+				t.Errorf("CharacterName is %q", join.CharacterName)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package client
+
+import (
+	"fmt"
+)
+
+// messageDirection tells requests, responses and events apart, as they share codes
+type messageDirection uint8
+
+const (
+	directionRequest messageDirection = iota
+	directionResponse
+	directionEvent
+)
+
+func (d messageDirection) String() string {
+	switch d {
+	case directionRequest:
+		return "request"
+	case directionResponse:
+		return "response"
+	case directionEvent:
+		return "event"
+	default:
+		return "unknown"
+	}
+}
+
+// operationFactory returns a new struct for a message to be decoded into
+type operationFactory func() operation
+
+type messageKey struct {
+	direction messageDirection
+	code      int16
+}
+
+// messageHandlers holds what every message is decoded into. Each handler of a message gets its
+// own copy, so storage, uploads and alerts can react to the same message independently.
+var messageHandlers = make(map[messageKey][]operationFactory)
+
+// registerRequest adds a handler for an operation request, usually from the init() of its file
+func registerRequest(code OperationType, factory operationFactory) {
+	registerHandler(directionRequest, int16(code), factory)
+}
+
+// registerResponse adds a handler for an operation response
+func registerResponse(code OperationType, factory operationFactory) {
+	registerHandler(directionResponse, int16(code), factory)
+}
+
+// registerEvent adds a handler for an event
+func registerEvent(code EventType, factory operationFactory) {
+	registerHandler(directionEvent, int16(code), factory)
+}
+
+func registerHandler(direction messageDirection, code int16, factory operationFactory) {
+	key := messageKey{direction: direction, code: code}
+	messageHandlers[key] = append(messageHandlers[key], factory)
+}
+
+// decodeMessage decodes the params of a message for every handler registered for it.
+// Handlers that fail to decode are left out unless DebugIgnoreDecodingErrors is set, the
+// error of the last one is returned.
+func decodeMessage(direction messageDirection, code int16, params map[uint8]interface{}) (operations []operation, err error) {
+	for _, factory := range messageHandlers[messageKey{direction: direction, code: code}] {
+		operation := factory()
+		if decodeErr := decodeParams(params, operation); decodeErr != nil {
+			err = fmt.Errorf("%T: %v", operation, decodeErr)
+			// Handlers get what could be decoded when decoding errors are ignored
+			if !ConfigGlobal.DebugIgnoreDecodingErrors {
+				continue
+			}
+		}
+		operations = append(operations, operation)
+	}
+
+	return operations, err
+}
+
+// decodedMessage is a message as decoded by each of its handlers, processed as one so
+// the handlers all see the same state
+type decodedMessage struct {
+	operations []operation
+	direction  messageDirection
+
+	// Requests and responses are matched by their message ID
+	messageID    uint64
+	hasMessageID bool
+}
+
+func (m decodedMessage) Process(state *albionState) {
+	if m.hasMessageID {
+		switch m.direction {
+		case directionRequest:
+			// Responses get the request as decoded by the first handler registered for it
+			state.pendingRequests.put(m.messageID, m.operations[0])
+		case directionResponse:
+			if request, found := state.pendingRequests.take(m.messageID); found {
+				for _, op := range m.operations {
+					if response, ok := op.(correlatedResponse); ok {
+						response.setRequest(request)
+					}
+				}
+			}
+		}
+	}
+
+	for _, op := range m.operations {
+		op.Process(state)
+	}
+}
@@ -3,28 +3,61 @@ package client
 import (
 	"encoding/gob"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/ao-data/albiondata-client/log"
 	photon "github.com/ao-data/photon_spectator"
 )
 
-//Router struct definitions
+// Router struct definitions
 type Router struct {
-	albionstate         *albionState
-	newOperation        chan operation
+	sessionsMu          sync.Mutex
+	sessions            map[string]*session
+	pool                *operationPool
 	recordPhotonCommand chan photon.PhotonCommand
 	quit                chan bool
 }
 
 func newRouter() *Router {
 	return &Router{
-		albionstate:         &albionState{LocationId: ""},
-		newOperation:        make(chan operation, 1000),
+		sessions:            make(map[string]*session),
+		pool:                newOperationPool(defaultOperationWorkers()),
 		recordPhotonCommand: make(chan photon.PhotonCommand, 1000),
 		quit:                make(chan bool, 1),
 	}
 }
 
+// session returns the session of a game server connection, creating it if it is new
+func (r *Router) session(key string, serverIP string) *session {
+	r.sessionsMu.Lock()
+	defer r.sessionsMu.Unlock()
+
+	s, ok := r.sessions[key]
+	if !ok {
+		s = newSession(key, serverIP, r.pool)
+		r.sessions[key] = s
+		log.Debugf("Started session %v (server ID: %v)", key, s.state.AODataServerID)
+	}
+	s.lastSeen = time.Now()
+
+	return s
+}
+
+// closeIdleSessions closes the sessions that have not seen traffic for a while, or all of them
+func (r *Router) closeIdleSessions(all bool) {
+	r.sessionsMu.Lock()
+	defer r.sessionsMu.Unlock()
+
+	for key, s := range r.sessions {
+		if all || time.Since(s.lastSeen) > sessionIdleTimeout {
+			state := s.snapshot()
+			log.Debugf("Closing session %v (character: %v, location: %v)", key, state.CharacterName, state.LocationId)
+			delete(r.sessions, key)
+		}
+	}
+}
+
 func (r *Router) run() {
 	var encoder *gob.Encoder
 	var file *os.File
@@ -37,10 +70,15 @@ func (r *Router) run() {
 		}
 	}
 
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
 	for {
 		select {
 		case <-r.quit:
 			log.Debug("Closing router...")
+			r.closeIdleSessions(true)
+			saveCatalog()
 			if file != nil {
 				err := file.Close()
 				if err != nil {
@@ -48,8 +86,9 @@ func (r *Router) run() {
 				}
 			}
 			return
-		case op := <-r.newOperation:
-			go op.Process(r.albionstate)
+		case <-ticker.C:
+			r.closeIdleSessions(false)
+			saveCatalog()
 		case command := <-r.recordPhotonCommand:
 			if encoder != nil {
 				err := encoder.Encode(command)
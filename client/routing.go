@@ -0,0 +1,94 @@
+package client
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// routingRule limits which topics are sent to which uploaders. Topics are matched
+// against the include and exclude patterns with path.Match, e.g. "market*" or "*.ingest".
+type routingRule struct {
+	// Ingest targets as given with -i or -p the rule applies to, all when empty
+	Targets []string `mapstructure:"targets"`
+	// Topics to send, all when empty
+	Include []string `mapstructure:"include"`
+	// Topics never to send, even when included
+	Exclude []string `mapstructure:"exclude"`
+	// Realms (west, east, europe) to send data of, all when empty
+	Realms []string `mapstructure:"realms"`
+}
+
+type routingRules []routingRule
+
+// allows reports whether a topic captured on a realm may be sent to a target. Targets
+// without rules get everything, otherwise one of their rules has to allow the topic.
+func (rules routingRules) allows(target string, topic string, realm string) bool {
+	matched := false
+	for _, rule := range rules {
+		if !rule.appliesTo(target) {
+			continue
+		}
+
+		matched = true
+		if rule.allows(topic, realm) {
+			return true
+		}
+	}
+
+	return !matched
+}
+
+func (rule routingRule) appliesTo(target string) bool {
+	if len(rule.Targets) == 0 {
+		return true
+	}
+
+	for _, t := range rule.Targets {
+		if t == target {
+			return true
+		}
+	}
+	return false
+}
+
+func (rule routingRule) allows(topic string, realm string) bool {
+	if len(rule.Include) > 0 && !matchesAnyTopic(rule.Include, topic) {
+		return false
+	}
+
+	if matchesAnyTopic(rule.Exclude, topic) {
+		return false
+	}
+
+	if len(rule.Realms) == 0 {
+		return true
+	}
+	for _, r := range rule.Realms {
+		if strings.EqualFold(r, realm) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAnyTopic(patterns []string, topic string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, topic); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// validate returns an error for the first malformed topic pattern
+func (rules routingRules) validate() error {
+	for _, rule := range rules {
+		for _, pattern := range append(append([]string{}, rule.Include...), rule.Exclude...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid topic pattern %q: %v", pattern, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ao-data/albiondata-client/log"
+)
+
+// Sessions without traffic for this long are closed.
+const sessionIdleTimeout = 30 * time.Minute
+
+// The ports the game servers use for photon traffic.
+var photonPorts = []int{5055, 5056}
+
+// session is the state of one connection to a game server. The operations of a session are processed
+// one at a time in the order they were captured, so they never see the state half updated, while
+// two game clients or the same traffic on multiple interfaces don't mix up their state.
+type session struct {
+	key   string
+	queue chan operationJob
+
+	mu    sync.Mutex
+	state *albionState
+
+	// Guarded by the mutex of the router
+	lastSeen time.Time
+}
+
+func newSession(key string, serverIP string, pool *operationPool) *session {
+	state := &albionState{
+		GameServerIP:    serverIP,
+		pendingRequests: newCorrelationStore(correlationTTL),
+	}
+	state.AODataServerID, state.AODataIngestBaseURL = state.GetServer()
+
+	return &session{
+		key:      key,
+		queue:    pool.queue(key),
+		state:    state,
+		lastSeen: time.Now(),
+	}
+}
+
+// enqueue queues an operation to be processed after the ones before it
+func (s *session) enqueue(op operation) {
+	s.queue <- operationJob{session: s, op: op}
+}
+
+func (s *session) process(op operation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	op.Process(s.state)
+}
+
+// snapshot returns a copy of the state as it is between two operations
+func (s *session) snapshot() albionState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *s.state
+}
+
+// sessionKey returns the key of the session a packet belongs to, which is the address of
+// the game server, no matter in which direction the packet went
+func sessionKey(srcIP string, srcPort int, dstIP string, dstPort int) (key string, serverIP string) {
+	for _, port := range photonPorts {
+		if srcPort == port {
+			return net.JoinHostPort(srcIP, strconv.Itoa(srcPort)), srcIP
+		}
+	}
+	return net.JoinHostPort(dstIP, strconv.Itoa(dstPort)), dstIP
+}
+
+// operationUndecryptable is queued for messages that could not be decrypted
+type operationUndecryptable struct{}
+
+func (op operationUndecryptable) Process(state *albionState) {
+	if state.WaitingForMarketData {
+		state.WaitingForMarketData = false
+		log.Info("Market data is encrypted. Please see https://www.albion-online-data.com/client/encryption.html for more information.")
+	}
+}
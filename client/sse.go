@@ -0,0 +1,182 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ao-data/albiondata-client/log"
+)
+
+// Time between comments keeping idle Server-Sent Events connections open.
+const ssePingPeriod = 30 * time.Second
+
+// sseClient is a Server-Sent Events connection registered with the hub
+type sseClient struct {
+	send         chan *wsMessage
+	subscription *wsSubscription
+
+	// The backlog the client asked for, the hub answers on registration
+	replay  *wsReplay
+	backlog chan []*wsMessage
+}
+
+// serveSSE streams the messages sent to the websockets as Server-Sent Events, e.g.
+//
+//	/events?topic=marketorders.ingest&topic=markethistories.ingest&item_prefix=T6_&location=3005
+//
+// Without a topic parameter every topic is sent. Clients reconnecting with a Last-Event-ID
+// header (or last_event_id parameter) first get the messages they missed, as far as they are
+// still in the backlog. See replayFromQuery for other ways to ask for the backlog.
+func serveSSE(hub *WSHub, w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Origin") != "" {
+		if !checkOrigin(r) {
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", r.Header.Get("Origin"))
+		w.Header().Set("Vary", "Origin")
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	replay, err := replayFromQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	client := &sseClient{
+		send:         make(chan *wsMessage, 256),
+		subscription: subscriptionFromQuery(r),
+		replay:       replay,
+		backlog:      make(chan []*wsMessage, 1),
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", (5 * time.Second).Milliseconds())
+	flusher.Flush()
+
+	hub.sseRegister <- client
+	defer func() {
+		hub.sseUnregister <- client
+	}()
+
+	for _, message := range <-client.backlog {
+		if err := writeSSEEvent(w, message); err != nil {
+			log.Debugf("Error while writing server-sent event: %v", err)
+			return
+		}
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(ssePingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case message, ok := <-client.send:
+			if !ok {
+				// The hub dropped us for not keeping up
+				return
+			}
+			if err := writeSSEEvent(w, message); err != nil {
+				log.Debugf("Error while writing server-sent event: %v", err)
+				return
+			}
+			flusher.Flush()
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// subscriptionFromQuery builds the subscription of a client from the query parameters
+// topic (repeated or comma separated), item_prefix, location and realm
+func subscriptionFromQuery(r *http.Request) *wsSubscription {
+	query := r.URL.Query()
+	s := newWSSubscription()
+
+	var topics []string
+	for _, v := range query["topic"] {
+		for _, topic := range strings.Split(v, ",") {
+			if topic = strings.TrimSpace(topic); topic != "" {
+				topics = append(topics, topic)
+			}
+		}
+	}
+
+	s.handleRequest(&wsRequest{
+		Action: "subscribe",
+		Topics: topics,
+		Filter: &wsFilter{
+			ItemPrefix: query.Get("item_prefix"),
+			Location:   query.Get("location"),
+			Realm:      query.Get("realm"),
+		},
+	})
+	if len(topics) == 0 {
+		s.topics["*"] = true
+	}
+
+	return s
+}
+
+// replayFromQuery returns the backlog a client asks for when connecting, if any: the messages after
+// a Last-Event-ID header or last_event_id parameter, the ones of the last since=10m, or all of them with replay=true
+func replayFromQuery(r *http.Request) (*wsReplay, error) {
+	query := r.URL.Query()
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = query.Get("last_event_id")
+	}
+	all, _ := strconv.ParseBool(query.Get("replay"))
+
+	if lastEventID == "" && query.Get("since") == "" && !all {
+		return nil, nil
+	}
+
+	replay, err := (&wsRequest{Since: query.Get("since")}).replay()
+	if err != nil {
+		return nil, err
+	}
+
+	if lastEventID != "" {
+		replay.afterID, err = strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid last event id: %v", err)
+		}
+	}
+
+	return replay, nil
+}
+
+func writeSSEEvent(w http.ResponseWriter, message *wsMessage) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "id: %d\n", message.id)
+	for _, line := range bytes.Split(message.payload, newline) {
+		buf.WriteString("data: ")
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
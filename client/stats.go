@@ -0,0 +1,26 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ao-data/albiondata-client/log"
+)
+
+// clientStats is what /stats reports about the uploads
+type clientStats struct {
+	UploadQueueDepth     int               `json:"upload_queue_depth"`
+	SuppressedDuplicates map[string]uint64 `json:"suppressed_duplicates"`
+}
+
+func serveStats(w http.ResponseWriter, r *http.Request) {
+	stats := clientStats{
+		UploadQueueDepth:     UploadQueueDepth(),
+		SuppressedDuplicates: UploadDedupeStats(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		log.Debugf("Error while writing stats: %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/ao-data/albiondata-client/log"
+)
+
+var uploadDedupe *uploadDeduper
+
+// uploadDeduper remembers the payloads sent recently so identical ones, e.g. from scrolling
+// back and forth through market pages, are not uploaded again until the TTL expires
+type uploadDeduper struct {
+	ttl time.Duration
+
+	mu         sync.Mutex
+	seen       map[[sha256.Size]byte]time.Time
+	suppressed map[string]uint64
+	lastPrune  time.Time
+}
+
+func newUploadDeduper(ttl time.Duration) *uploadDeduper {
+	return &uploadDeduper{
+		ttl:        ttl,
+		seen:       make(map[[sha256.Size]byte]time.Time),
+		suppressed: make(map[string]uint64),
+		lastPrune:  time.Now(),
+	}
+}
+
+// isDuplicate reports whether the same payload was already sent for the topic and server
+// within the TTL, and remembers it otherwise
+func (d *uploadDeduper) isDuplicate(topic string, serverID int, body []byte) bool {
+	h := sha256.New()
+	h.Write([]byte(topic))
+	var server [8]byte
+	binary.BigEndian.PutUint64(server[:], uint64(serverID))
+	h.Write(server[:])
+	h.Write(body)
+
+	var key [sha256.Size]byte
+	copy(key[:], h.Sum(nil))
+
+	now := time.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if now.Sub(d.lastPrune) > d.ttl {
+		d.prune(now)
+	}
+
+	if expires, ok := d.seen[key]; ok && now.Before(expires) {
+		d.suppressed[topic]++
+		log.Debugf("Suppressed duplicate %v upload (%d suppressed for this topic)", topic, d.suppressed[topic])
+		return true
+	}
+
+	d.seen[key] = now.Add(d.ttl)
+	return false
+}
+
+// prune forgets expired payloads. d.mu must be held.
+func (d *uploadDeduper) prune(now time.Time) {
+	for key, expires := range d.seen {
+		if !now.Before(expires) {
+			delete(d.seen, key)
+		}
+	}
+	d.lastPrune = now
+}
+
+// UploadDedupeStats returns the number of duplicate uploads suppressed per topic
+func UploadDedupeStats() map[string]uint64 {
+	stats := make(map[string]uint64)
+	if uploadDedupe == nil {
+		return stats
+	}
+
+	uploadDedupe.mu.Lock()
+	defer uploadDedupe.mu.Unlock()
+
+	for topic, count := range uploadDedupe.suppressed {
+		stats[topic] = count
+	}
+	return stats
+}
@@ -1,5 +1,36 @@
 package client
 
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
 type uploader interface {
-	sendToIngest(body []byte, topic string, state *albionState, identifier string)
+	sendToIngest(body []byte, topic string, state *albionState, identifier string) error
+}
+
+// ingestStatusError is returned when an ingest answers an upload with a status code other than success
+type ingestStatusError struct {
+	code int
+	msg  string
+}
+
+func newIngestStatusError(code int, format string, args ...interface{}) error {
+	return &ingestStatusError{code: code, msg: fmt.Sprintf(format, args...)}
+}
+
+func (e *ingestStatusError) Error() string {
+	return e.msg
+}
+
+// retryableUpload returns whether sending an upload that failed with err again may work. Network
+// errors, full queues and servers that are overloaded or down (429, 5xx) may go away, any other
+// answer of the ingest (e.g. 400, 401, 403, 413) means it won't take the upload however often it is sent.
+func retryableUpload(err error) bool {
+	var statusErr *ingestStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.code == http.StatusTooManyRequests || statusErr.code >= 500
+	}
+	return true
 }
@@ -0,0 +1,134 @@
+package client
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/ao-data/albiondata-client/lib"
+	"github.com/ao-data/albiondata-client/log"
+	uuid "github.com/nu7hatch/gouuid"
+)
+
+// batchMergers combine several payloads of a topic into a single payload the ingest
+// servers accept as is. Topics without a merger are sent straight through.
+var batchMergers = map[string]func(bodies [][]byte) ([]byte, error){
+	lib.NatsMarketOrdersIngest: mergeMarketUploads,
+}
+
+func mergeMarketUploads(bodies [][]byte) ([]byte, error) {
+	merged := lib.MarketUpload{}
+	for _, body := range bodies {
+		upload := lib.MarketUpload{}
+		if err := json.Unmarshal(body, &upload); err != nil {
+			return nil, err
+		}
+		merged.Orders = append(merged.Orders, upload.Orders...)
+	}
+	return json.Marshal(merged)
+}
+
+var (
+	uploadBatchersMu sync.Mutex
+	uploadBatchers   = make(map[string]*batchingUploader)
+)
+
+// getUploadBatcher returns the batching uploader of a target, creating it around next
+// on first use so pending batches are shared between messages
+func getUploadBatcher(target string, next uploader) uploader {
+	uploadBatchersMu.Lock()
+	defer uploadBatchersMu.Unlock()
+
+	if b, ok := uploadBatchers[target]; ok {
+		return b
+	}
+
+	b := &batchingUploader{
+		target:  target,
+		next:    next,
+		window:  ConfigGlobal.UploadBatchWindow,
+		maxSize: ConfigGlobal.UploadBatchMaxBytes,
+		pending: make(map[uploadBatchKey]*uploadBatch),
+	}
+	uploadBatchers[target] = b
+	return b
+}
+
+type uploadBatchKey struct {
+	topic    string
+	serverID int
+}
+
+type uploadBatch struct {
+	bodies [][]byte
+	size   int
+	timer  *time.Timer
+
+	// Capture time of the first payload
+	capturedAt time.Time
+}
+
+// batchingUploader groups the payloads of a topic that arrive within a time window
+// and sends them as one upload. Payloads of different servers are never mixed.
+type batchingUploader struct {
+	target  string
+	next    uploader
+	window  time.Duration
+	maxSize int
+
+	mu      sync.Mutex
+	pending map[uploadBatchKey]*uploadBatch
+}
+
+func (u *batchingUploader) sendToIngest(body []byte, topic string, state *albionState, identifier string) error {
+	if _, ok := batchMergers[topic]; !ok {
+		return u.next.sendToIngest(body, topic, state, identifier)
+	}
+
+	key := uploadBatchKey{topic: topic, serverID: state.AODataServerID}
+
+	u.mu.Lock()
+	batch, ok := u.pending[key]
+	if !ok {
+		batch = &uploadBatch{capturedAt: state.CapturedAt}
+		batch.timer = time.AfterFunc(u.window, func() {
+			u.flush(key, batch)
+		})
+		u.pending[key] = batch
+	}
+	batch.bodies = append(batch.bodies, body)
+	batch.size += len(body)
+	full := batch.size >= u.maxSize
+	u.mu.Unlock()
+
+	if full {
+		batch.timer.Stop()
+		u.flush(key, batch)
+	}
+	return nil
+}
+
+func (u *batchingUploader) flush(key uploadBatchKey, batch *uploadBatch) {
+	u.mu.Lock()
+	if u.pending[key] != batch {
+		// Already flushed by the size limit or the timer
+		u.mu.Unlock()
+		return
+	}
+	delete(u.pending, key)
+	u.mu.Unlock()
+
+	body, err := batchMergers[key.topic](batch.bodies)
+	if err != nil {
+		log.Errorf("Could not merge %d %v payloads for %v: %v", len(batch.bodies), key.topic, u.target, err)
+		return
+	}
+
+	identifier, _ := uuid.NewV4()
+	log.Debugf("Sending batch of %d %v payloads to %v (Identifier: %s)", len(batch.bodies), key.topic, u.target, identifier)
+
+	state := &albionState{AODataServerID: key.serverID, CapturedAt: batch.capturedAt}
+	if err := u.next.sendToIngest(body, key.topic, state, identifier.String()); err != nil {
+		log.Errorf("Error while sending %v batch to ingest: %v", key.topic, err)
+	}
+}
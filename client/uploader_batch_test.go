@@ -0,0 +1,35 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ao-data/albiondata-client/lib"
+)
+
+func TestBatchKeepsCaptureTime(t *testing.T) {
+	recording := &recordingUploader{}
+	u := &batchingUploader{
+		target:  "recording://batch",
+		next:    recording,
+		window:  time.Hour,
+		maxSize: 40,
+		pending: make(map[uploadBatchKey]*uploadBatch),
+	}
+
+	first := time.Now().UTC().Add(-time.Minute)
+	body := []byte(`{"Orders":[{"Id":1}]}`)
+	for i, capturedAt := range []time.Time{first, first.Add(time.Second)} {
+		if err := u.sendToIngest(body, lib.NatsMarketOrdersIngest, &albionState{AODataServerID: 1, CapturedAt: capturedAt}, "id"); err != nil {
+			t.Fatalf("payload %d: %v", i, err)
+		}
+	}
+
+	// The second payload filled the batch, which was sent right away
+	if len(recording.states) != 1 {
+		t.Fatalf("sent %d batches", len(recording.states))
+	}
+	if state := recording.states[0]; !state.CapturedAt.Equal(first) || state.AODataServerID != 1 {
+		t.Errorf("batch sent for server %d captured at %v, wanted the capture time of its first payload %v", state.AODataServerID, state.CapturedAt, first)
+	}
+}
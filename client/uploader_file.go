@@ -0,0 +1,142 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ao-data/albiondata-client/log"
+)
+
+const defaultFileUploaderMaxSize = 64 * 1024 * 1024
+
+type fileUploader struct {
+	dir     string
+	maxSize int64
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+	day  string
+}
+
+// fileRecord is one line of the JSONL feed
+type fileRecord struct {
+	// When the data was captured, which for spooled and batched uploads is before the record is written
+	Timestamp  time.Time       `json:"timestamp"`
+	Topic      string          `json:"topic"`
+	Realm      string          `json:"realm"`
+	ServerID   int             `json:"server_id"`
+	Identifier string          `json:"identifier"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// newFileUploader creates an uploader writing every payload as a line of JSON to files in a directory,
+// e.g. file://./albiondata-feed or file:///var/lib/albiondata?max_size=10485760
+// A new file is started every day and whenever the current one reaches max_size bytes.
+func newFileUploader(target string) uploader {
+	dir := strings.TrimPrefix(target, "file://")
+	maxSize := int64(defaultFileUploaderMaxSize)
+
+	if i := strings.Index(dir, "?"); i >= 0 {
+		query, err := url.ParseQuery(dir[i+1:])
+		if err != nil {
+			log.Errorf("Invalid file ingest target %v: %v", target, err)
+			return nil
+		}
+		dir = dir[:i]
+
+		if v := query.Get("max_size"); v != "" {
+			maxSize, err = strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				log.Errorf("Invalid max_size in file ingest target %v: %v", target, err)
+				return nil
+			}
+		}
+	}
+
+	if dir == "" {
+		log.Errorf("File ingest target %v has no directory", target)
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Errorf("Could not create directory for file ingest target %v: %v", target, err)
+		return nil
+	}
+
+	return &fileUploader{
+		dir:     dir,
+		maxSize: maxSize,
+	}
+}
+
+func (u *fileUploader) sendToIngest(body []byte, topic string, state *albionState, identifier string) error {
+	now := time.Now().UTC()
+	capturedAt := state.CapturedAt
+	if capturedAt.IsZero() {
+		capturedAt = now
+	}
+
+	line, err := json.Marshal(fileRecord{
+		Timestamp:  capturedAt,
+		Topic:      topic,
+		Realm:      realmName(state.AODataServerID),
+		ServerID:   state.AODataServerID,
+		Identifier: identifier,
+		Data:       body,
+	})
+	if err != nil {
+		return fmt.Errorf("error while encoding %v record: %v", topic, err)
+	}
+	line = append(line, '\n')
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if err := u.rotate(now, int64(len(line))); err != nil {
+		return err
+	}
+
+	n, err := u.file.Write(line)
+	u.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("error while writing to %v: %v", u.file.Name(), err)
+	}
+
+	log.Debugf("Wrote %v to %v", topic, u.file.Name())
+	return nil
+}
+
+// rotate makes sure there is an open file for the day that still has room for the next record
+func (u *fileUploader) rotate(now time.Time, next int64) error {
+	day := now.Format("20060102")
+	if u.file != nil && u.day == day && (u.size == 0 || u.size+next <= u.maxSize) {
+		return nil
+	}
+
+	if u.file != nil {
+		if err := u.file.Close(); err != nil {
+			log.Errorf("Could not close %v: %v", u.file.Name(), err)
+		}
+		u.file = nil
+	}
+
+	name := filepath.Join(u.dir, fmt.Sprintf("albiondata-%s.jsonl", now.Format("20060102-150405.000000000")))
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("could not open %v: %v", name, err)
+	}
+
+	log.Infof("Writing ingest feed to %v", name)
+	u.file = file
+	u.size = 0
+	u.day = day
+	return nil
+}
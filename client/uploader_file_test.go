@@ -0,0 +1,151 @@
+package client
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// feedFiles returns the files a file uploader wrote, in the order they were started
+func feedFiles(t *testing.T, dir string) []string {
+	files, err := filepath.Glob(filepath.Join(dir, "albiondata-*.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func readFeed(t *testing.T, path string) []fileRecord {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var records []fileRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record fileRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("line %d of %v is not a JSON record: %v", len(records)+1, path, err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func newTestFileUploader(t *testing.T, query string) (*fileUploader, string) {
+	dir := filepath.Join(t.TempDir(), "feed")
+	u, ok := newFileUploader("file://" + dir + query).(*fileUploader)
+	if !ok {
+		t.Fatalf("no file uploader for %v", dir+query)
+	}
+	t.Cleanup(func() {
+		if u.file != nil {
+			u.file.Close()
+		}
+	})
+	return u, dir
+}
+
+func TestFileUploaderRecords(t *testing.T) {
+	u, dir := newTestFileUploader(t, "")
+
+	capturedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	state := &albionState{AODataServerID: 1, CapturedAt: capturedAt}
+	if err := u.sendToIngest([]byte(`{"Prices":[4000]}`), "goldprices.ingest", state, "first"); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.sendToIngest([]byte(`{"Orders":[]}`), "marketorders.ingest", &albionState{AODataServerID: 3}, "second"); err != nil {
+		t.Fatal(err)
+	}
+
+	files := feedFiles(t, dir)
+	if len(files) != 1 {
+		t.Fatalf("wrote %d files", len(files))
+	}
+	records := readFeed(t, files[0])
+	if len(records) != 2 {
+		t.Fatalf("wrote %d records", len(records))
+	}
+
+	first := records[0]
+	if first.Topic != "goldprices.ingest" || first.Realm != "west" || first.ServerID != 1 || first.Identifier != "first" || string(first.Data) != `{"Prices":[4000]}` {
+		t.Errorf("got record %+v", first)
+	}
+	if !first.Timestamp.Equal(capturedAt) {
+		t.Errorf("record is stamped %v, wanted the capture time %v", first.Timestamp, capturedAt)
+	}
+
+	// Without a capture time the record is stamped when it is written
+	if second := records[1]; second.Realm != "europe" || time.Since(second.Timestamp) > time.Minute {
+		t.Errorf("got record %+v", second)
+	}
+}
+
+func TestFileUploaderSizeRotation(t *testing.T) {
+	u, dir := newTestFileUploader(t, "?max_size=300")
+
+	for i := 0; i < 5; i++ {
+		if err := u.sendToIngest([]byte(`{"Prices":[4000,4001,4002]}`), "goldprices.ingest", &albionState{AODataServerID: 1}, "id"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files := feedFiles(t, dir)
+	if len(files) < 2 {
+		t.Fatalf("wrote %d files, wanted a new one whenever max_size is reached", len(files))
+	}
+
+	total := 0
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) > 300 {
+			t.Errorf("%v has %d bytes, more than max_size", file, len(data))
+		}
+		total += len(readFeed(t, file))
+	}
+	if total != 5 {
+		t.Errorf("wrote %d records over %d files, wanted 5", total, len(files))
+	}
+}
+
+func TestFileUploaderDailyRotation(t *testing.T) {
+	u, dir := newTestFileUploader(t, "")
+
+	lateEvening := time.Date(2024, 3, 1, 23, 59, 0, 0, time.UTC)
+	if err := u.rotate(lateEvening, 100); err != nil {
+		t.Fatal(err)
+	}
+	first := u.file.Name()
+
+	if err := u.rotate(lateEvening.Add(30*time.Second), 100); err != nil {
+		t.Fatal(err)
+	}
+	if u.file.Name() != first {
+		t.Errorf("started %v within the same day", u.file.Name())
+	}
+
+	if err := u.rotate(lateEvening.Add(2*time.Minute), 100); err != nil {
+		t.Fatal(err)
+	}
+	if u.file.Name() == first {
+		t.Error("kept writing to the file of the day before")
+	}
+
+	if files := feedFiles(t, dir); len(files) != 2 {
+		t.Errorf("got %d files, wanted one per day", len(files))
+	}
+}
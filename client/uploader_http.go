@@ -2,6 +2,8 @@ package client
 
 import (
 	"bytes"
+	"compress/gzip"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -22,36 +24,49 @@ func newHTTPUploader(url string) uploader {
 	}
 }
 
-func (u *httpUploader) sendToIngest(body []byte, topic string, state *albionState, identifier string) {
+func (u *httpUploader) sendToIngest(body []byte, topic string, state *albionState, identifier string) error {
 	// not handling sending identifier since the official usage is with http_pow
 
 	client := &http.Client{Transport: u.transport}
 
 	fullURL := u.baseURL + "/" + topic
 
+	if ConfigGlobal.UploadGzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(body); err != nil {
+			return fmt.Errorf("error while compressing body: %v", err)
+		}
+		if err := zw.Close(); err != nil {
+			return fmt.Errorf("error while compressing body: %v", err)
+		}
+		body = buf.Bytes()
+	}
+
 	req, err := http.NewRequest("POST", fullURL, bytes.NewBuffer([]byte(body)))
 	if err != nil {
-		log.Errorf("Error while create new request: %v", err)
-		return
+		return fmt.Errorf("error while create new request: %v", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
+	if ConfigGlobal.UploadGzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
 
 	resp, err := client.Do(req)
 	if err != nil {
-		log.Errorf("Error while sending ingest with data: %v", err)
-		return
-	}
-
-	if resp.StatusCode != 200 {
-		log.Errorf("Got bad response code: %v", resp.StatusCode)
-		return
+		return fmt.Errorf("error while sending ingest with data: %v", err)
 	}
+	defer resp.Body.Close()
 
 	// See: https://stackoverflow.com/questions/17948827/reusing-http-connections-in-golang
 	io.Copy(ioutil.Discard, resp.Body)
 
+	if resp.StatusCode != 200 {
+		return newIngestStatusError(resp.StatusCode, "got bad response code: %v", resp.StatusCode)
+	}
+
 	log.Infof("Successfully sent ingest request to %v", u.baseURL)
 
-	defer resp.Body.Close()
+	return nil
 }
@@ -1,9 +1,10 @@
 package client
 
 import (
-	"bytes"
+	"context"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -13,6 +14,9 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/ao-data/albiondata-client/log"
 )
@@ -20,11 +24,26 @@ import (
 type httpUploaderPow struct {
 	baseURL   string
 	transport *http.Transport
+
+	// A solved pow the server allows to be used for more uploads
+	solvedMu sync.Mutex
+	solved   *solvedPow
 }
 
 type Pow struct {
 	Key    string `json:"key"`
 	Wanted string `json:"wanted"`
+
+	// Optional, sent by servers that accept the same solution for several uploads
+	Uses    int   `json:"uses,omitempty"`
+	Expires int64 `json:"expires,omitempty"`
+}
+
+type solvedPow struct {
+	pow       Pow
+	solution  string
+	remaining int
+	expires   time.Time
 }
 
 // newHTTPUploaderPow creates a new HTTP uploader
@@ -32,11 +51,7 @@ func newHTTPUploaderPow(url string) uploader {
 
 	if !ConfigGlobal.NoCPULimit {
 		// Limit to 25% of available cpu cores
-		procs := runtime.NumCPU() / 4
-		if procs < 1 {
-			procs = 1
-		}
-		runtime.GOMAXPROCS(procs)
+		runtime.GOMAXPROCS(powWorkers())
 	}
 
 	url = strings.Replace(url, "https+pow", "https", -1)
@@ -48,7 +63,7 @@ func newHTTPUploaderPow(url string) uploader {
 	}
 }
 
-func (u *httpUploaderPow) getPow(target interface{}) {
+func (u *httpUploaderPow) getPow(target interface{}) error {
 	log.Debugf("GETTING POW")
 	fullURL := u.baseURL + "/pow"
 
@@ -58,27 +73,26 @@ func (u *httpUploaderPow) getPow(target interface{}) {
 	resp, err := client.Do(req)
 
 	if err != nil {
-		log.Errorf("Error in Pow Get request: %v", err)
-		return
+		return fmt.Errorf("error in pow get request: %v", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		log.Errorf("Got bad response code: %v", resp.StatusCode)
-		return
+		return newIngestStatusError(resp.StatusCode, "got bad response code for pow: %v", resp.StatusCode)
 	}
 
-	json.NewDecoder(resp.Body).Decode(target)
+	err = json.NewDecoder(resp.Body).Decode(target)
 	if err != nil {
-		log.Errorf("Error in parsing Pow Get request: %v", err)
-		return
+		return fmt.Errorf("error in parsing pow get request: %v", err)
 	}
+
+	return nil
 }
 
 // Proves to the server that a pow was solved by submitting
 // the pow's key, the solution and a nats msg as a POST request
 // the topic becomes part of the URL
-func (u *httpUploaderPow) uploadWithPow(pow Pow, solution string, natsmsg []byte, topic string, serverid int, identifier string) {
+func (u *httpUploaderPow) uploadWithPow(pow Pow, solution string, natsmsg []byte, topic string, serverid int, identifier string) error {
 
 	fullURL := u.baseURL + "/pow/" + topic
 
@@ -95,8 +109,7 @@ func (u *httpUploaderPow) uploadWithPow(pow Pow, solution string, natsmsg []byte
 	resp, err := client.Do(req)
 
 	if err != nil {
-		log.Errorf("Error while proving pow: %v", err)
-		return
+		return fmt.Errorf("error while proving pow: %v", err)
 	}
 
 	defer resp.Body.Close()
@@ -104,46 +117,147 @@ func (u *httpUploaderPow) uploadWithPow(pow Pow, solution string, natsmsg []byte
 	if resp.StatusCode != 200 {
 		body, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
-			log.Fatal(err)
+			return newIngestStatusError(resp.StatusCode, "HTTP error while proving pow. returned: %v (could not read body: %v)", resp.StatusCode, err)
 		}
-		log.Errorf("HTTP Error while proving pow. returned: %v (%v)", resp.StatusCode, string(body))
-		return
+		return newIngestStatusError(resp.StatusCode, "HTTP error while proving pow. returned: %v (%v)", resp.StatusCode, string(body))
 	}
 
 	log.Infof("Successfully sent ingest request to %v", u.baseURL)
+
+	return nil
 }
 
-// Generates a random hex string e.g.: faa2743d9181dca5
-func randomHex(n int) string {
-    b := make([]byte, n)
-    rand.Read(b)
-    dst := make([]byte, n*2)
-    hex.Encode(dst, b)
-    return string(dst)
+// powStats describes the work done to solve a pow
+type powStats struct {
+	Attempts uint64
+	Workers  int
+	Duration time.Duration
+}
+
+// HashRate returns the number of hashes per second
+func (s powStats) HashRate() float64 {
+	if s.Duration <= 0 {
+		return 0
+	}
+	return float64(s.Attempts) / s.Duration.Seconds()
+}
+
+// powWorkers returns how many goroutines may be used to solve a pow,
+// 25% of the available cpu cores unless the cpu limit is disabled
+func powWorkers() int {
+	if ConfigGlobal.NoCPULimit {
+		return runtime.NumCPU()
+	}
+
+	procs := runtime.NumCPU() / 4
+	if procs < 1 {
+		procs = 1
+	}
+	return procs
 }
 
-// Converts a string to bits e.g.: 0110011...
-func toBinaryBytes(s string) string {
-	var buffer bytes.Buffer
-	for i := 0; i < len(s); i++ {
-		fmt.Fprintf(&buffer, "%08b", s[i])
+// validatePow makes sure a pow can be solved at all. Wanted is compared against the
+// bits of the hex encoded sha256 hash, so it can be at most 512 bits of 0s and 1s.
+func validatePow(pow Pow) error {
+	if pow.Key == "" {
+		return fmt.Errorf("pow has no key")
+	}
+	if len(pow.Wanted) == 0 || len(pow.Wanted) > 512 {
+		return fmt.Errorf("pow wanted has invalid length %d", len(pow.Wanted))
 	}
-	return fmt.Sprintf("%s", buffer.Bytes())
+	for i := 0; i < len(pow.Wanted); i++ {
+		if pow.Wanted[i] != '0' && pow.Wanted[i] != '1' {
+			return fmt.Errorf("pow wanted contains invalid character %q", pow.Wanted[i])
+		}
+	}
+	return nil
 }
 
-// Solves a pow looping through possible solutions
-// until a correct one is found
+// Solves a pow by splitting the search across workers
+// until a correct one is found or ctx is done
 // returns the solution
-func solvePow(pow Pow) string {
+func solvePow(ctx context.Context, pow Pow, workers int) (string, powStats, error) {
+	stats := powStats{Workers: workers}
+
+	if err := validatePow(pow); err != nil {
+		return "", stats, err
+	}
+	if workers < 1 {
+		workers = 1
+		stats.Workers = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	start := time.Now()
+	solutions := make(chan string, workers)
+	var attempts uint64
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n, solution := searchPow(ctx, pow)
+			atomic.AddUint64(&attempts, n)
+			if solution != "" {
+				solutions <- solution
+			}
+		}()
+	}
+
+	var solution string
+	select {
+	case solution = <-solutions:
+	case <-ctx.Done():
+	}
+	cancel()
+	wg.Wait()
+
+	stats.Attempts = atomic.LoadUint64(&attempts)
+	stats.Duration = time.Since(start)
+
+	if solution == "" {
+		return "", stats, fmt.Errorf("pow not solved after %d attempts: %v", stats.Attempts, ctx.Err())
+	}
+	return solution, stats, nil
+}
+
+// searchPow tries candidates starting at a random offset until one matches
+// or ctx is done, returns the number of attempts and the solution if any
+func searchPow(ctx context.Context, pow Pow) (uint64, string) {
 	wantedLen := len(pow.Wanted)
 	var hexBuf [64]byte
 	var binBuf [512]byte
 
+	// Every candidate is 16 random bytes, the last 8 of them are used as a counter
+	// so the workers do not need to read from crypto/rand for every attempt
+	var candidate [16]byte
+	rand.Read(candidate[:])
+	counter := binary.BigEndian.Uint64(candidate[8:])
+	var randhex [32]byte
+
 	prefix := "aod^"
-	sep := "^"
+	sep := "^" + pow.Key
+
+	var attempts uint64
 	for {
-		randhex := randomHex(16)
-		challenge := prefix + randhex + sep + pow.Key
+		// Only check for cancellation every now and then, it is comparatively expensive
+		if attempts%1024 == 0 {
+			select {
+			case <-ctx.Done():
+				return attempts, ""
+			default:
+			}
+		}
+		attempts++
+
+		counter++
+		binary.BigEndian.PutUint64(candidate[8:], counter)
+		hex.Encode(randhex[:], candidate[:])
+
+		challenge := prefix + string(randhex[:]) + sep
 		hash := sha256.Sum256([]byte(challenge))
 		hex.Encode(hexBuf[:], hash[:])
 
@@ -166,14 +280,87 @@ func solvePow(pow Pow) string {
 			}
 		}
 		if string(binBuf[:wantedLen]) == pow.Wanted {
-			return randhex
+			return attempts, string(randhex[:])
 		}
 	}
 }
 
-func (u *httpUploaderPow) sendToIngest(body []byte, topic string, state *albionState, identifier string) {
+// takeSolvedPow returns a previously solved pow that may still be used, if any
+func (u *httpUploaderPow) takeSolvedPow() (Pow, string, bool) {
+	u.solvedMu.Lock()
+	defer u.solvedMu.Unlock()
+
+	if u.solved == nil {
+		return Pow{}, "", false
+	}
+
+	if u.solved.remaining < 1 || (!u.solved.expires.IsZero() && time.Now().After(u.solved.expires)) {
+		u.solved = nil
+		return Pow{}, "", false
+	}
+
+	u.solved.remaining--
+	return u.solved.pow, u.solved.solution, true
+}
+
+// keepSolvedPow remembers a solved pow if the server allows it to be used again
+func (u *httpUploaderPow) keepSolvedPow(pow Pow, solution string) {
+	u.solvedMu.Lock()
+	defer u.solvedMu.Unlock()
+
+	if pow.Uses < 2 {
+		u.solved = nil
+		return
+	}
+
+	u.solved = &solvedPow{
+		pow:       pow,
+		solution:  solution,
+		remaining: pow.Uses - 1,
+	}
+	if pow.Expires > 0 {
+		u.solved.expires = time.Unix(pow.Expires, 0)
+	}
+}
+
+func (u *httpUploaderPow) dropSolvedPow() {
+	u.solvedMu.Lock()
+	defer u.solvedMu.Unlock()
+
+	u.solved = nil
+}
+
+func (u *httpUploaderPow) sendToIngest(body []byte, topic string, state *albionState, identifier string) error {
+	if pow, solution, ok := u.takeSolvedPow(); ok {
+		err := u.uploadWithPow(pow, solution, body, topic, state.AODataServerID, identifier)
+		if err == nil {
+			return nil
+		}
+
+		// The server did not take the solution again, start over with a fresh pow
+		log.Debugf("Reused pow was rejected, getting a new one: %v", err)
+		u.dropSolvedPow()
+	}
+
 	pow := Pow{}
-	u.getPow(&pow)
-	solution := solvePow(pow)
-	u.uploadWithPow(pow, solution, body, topic, state.AODataServerID, identifier)
+	if err := u.getPow(&pow); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ConfigGlobal.PowTimeout)
+	defer cancel()
+
+	solution, stats, err := solvePow(ctx, pow, powWorkers())
+	if err != nil {
+		return fmt.Errorf("could not solve pow: %v", err)
+	}
+	log.Debugf("Solved pow in %v with %d workers (%d attempts, %.0f H/s)", stats.Duration, stats.Workers, stats.Attempts, stats.HashRate())
+
+	err = u.uploadWithPow(pow, solution, body, topic, state.AODataServerID, identifier)
+	if err != nil {
+		return err
+	}
+
+	u.keepSolvedPow(pow, solution)
+	return nil
 }
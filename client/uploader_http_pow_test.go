@@ -0,0 +1,191 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// powBits returns the bits of the hex encoded hash the server checks a solution with
+func powBits(key string, solution string) string {
+	hash := sha256.Sum256([]byte("aod^" + solution + "^" + key))
+	var bits strings.Builder
+	for _, c := range []byte(hex.EncodeToString(hash[:])) {
+		fmt.Fprintf(&bits, "%08b", c)
+	}
+	return bits.String()
+}
+
+// Matched by the hashes starting with "33", about one in 256
+const testPowWanted = "0011001100110011"
+
+func TestSolvePow(t *testing.T) {
+	pow := Pow{Key: "key", Wanted: testPowWanted}
+
+	solution, stats, err := solvePow(context.Background(), pow, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bits := powBits(pow.Key, solution); !strings.HasPrefix(bits, pow.Wanted) {
+		t.Errorf("solution %v hashes to %v..., wanted %v", solution, bits[:len(pow.Wanted)], pow.Wanted)
+	}
+	if stats.Workers != 4 || stats.Attempts == 0 {
+		t.Errorf("got stats %+v", stats)
+	}
+}
+
+func TestSolvePowInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		pow  Pow
+		err  string
+	}{
+		{name: "no key", pow: Pow{Wanted: "0"}, err: "pow has no key"},
+		{name: "nothing wanted", pow: Pow{Key: "key"}, err: "pow wanted has invalid length 0"},
+		{name: "more wanted than the hash has", pow: Pow{Key: "key", Wanted: strings.Repeat("0", 513)}, err: "pow wanted has invalid length 513"},
+		{name: "not bits", pow: Pow{Key: "key", Wanted: "0102"}, err: "pow wanted contains invalid character '2'"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, stats, err := solvePow(context.Background(), test.pow, 2)
+			if err == nil || err.Error() != test.err {
+				t.Fatalf("got error %v, wanted %v", err, test.err)
+			}
+			if stats.Attempts != 0 {
+				t.Errorf("made %d attempts", stats.Attempts)
+			}
+		})
+	}
+}
+
+func TestSolvePowCancelled(t *testing.T) {
+	// The hex encoded hash is made of ASCII characters, whose first bit is never set
+	pow := Pow{Key: "key", Wanted: "1"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	done := make(chan struct{})
+	var stats powStats
+	var err error
+	go func() {
+		defer close(done)
+		// solvePow returns once every worker stopped
+		_, stats, err = solvePow(ctx, pow, 4)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("workers did not stop when the context was done")
+	}
+
+	if err == nil || !strings.Contains(err.Error(), context.DeadlineExceeded.Error()) {
+		t.Errorf("got error %v, wanted the deadline", err)
+	}
+	if stats.Attempts == 0 {
+		t.Error("made no attempts before the deadline")
+	}
+}
+
+// powServer hands out pows and counts the uploads proven with them
+type powServer struct {
+	*httptest.Server
+	pow Pow
+
+	mu       sync.Mutex
+	pows     int
+	uploads  int
+	rejected int
+	// Solutions accepted once only, like a server that forgot the pow
+	once bool
+	used map[string]bool
+}
+
+func newPowServer(t *testing.T, pow Pow, once bool) *powServer {
+	s := &powServer{pow: pow, once: once, used: make(map[string]bool)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if r.Method == "GET" && r.URL.Path == "/pow" {
+			s.pows++
+			pow := s.pow
+			pow.Key = fmt.Sprintf("key-%d", s.pows)
+			json.NewEncoder(w).Encode(pow)
+			return
+		}
+
+		// The form comes without a content type, so r.FormValue would not see it
+		body, _ := ioutil.ReadAll(r.Body)
+		form, _ := url.ParseQuery(string(body))
+		key, solution := form.Get("key"), form.Get("solution")
+		if r.URL.Path != "/pow/marketorders.ingest" || !strings.HasPrefix(powBits(key, solution), s.pow.Wanted) || (s.once && s.used[key]) {
+			s.rejected++
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		s.used[key] = true
+		s.uploads++
+	}))
+	t.Cleanup(s.Close)
+
+	timeout := ConfigGlobal.PowTimeout
+	ConfigGlobal.PowTimeout = 10 * time.Second
+	t.Cleanup(func() { ConfigGlobal.PowTimeout = timeout })
+
+	return s
+}
+
+// counts returns the pows handed out, the uploads accepted and rejected
+func (s *powServer) counts() (int, int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pows, s.uploads, s.rejected
+}
+
+func TestPowReuse(t *testing.T) {
+	tests := []struct {
+		name     string
+		pow      Pow
+		once     bool
+		pows     int
+		rejected int
+	}{
+		{name: "single use", pow: Pow{Wanted: testPowWanted}, pows: 5},
+		{name: "reused", pow: Pow{Wanted: testPowWanted, Uses: 3}, pows: 2},
+		{name: "reused until it expires", pow: Pow{Wanted: testPowWanted, Uses: 3, Expires: time.Now().Add(time.Hour).Unix()}, pows: 2},
+		{name: "expired", pow: Pow{Wanted: testPowWanted, Uses: 3, Expires: time.Now().Add(-time.Minute).Unix()}, pows: 5},
+		{name: "reuse rejected", pow: Pow{Wanted: testPowWanted, Uses: 3}, once: true, pows: 5, rejected: 4},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newPowServer(t, test.pow, test.once)
+			u := &httpUploaderPow{baseURL: server.URL, transport: &http.Transport{}}
+
+			for i := 0; i < 5; i++ {
+				if err := u.sendToIngest([]byte("{}"), "marketorders.ingest", &albionState{AODataServerID: 1}, "id"); err != nil {
+					t.Fatalf("upload %d: %v", i, err)
+				}
+			}
+
+			pows, uploads, rejected := server.counts()
+			if pows != test.pows || uploads != 5 || rejected != test.rejected {
+				t.Errorf("got %d pows for %d uploads with %d rejected, wanted %d pows for 5 uploads with %d rejected",
+					pows, uploads, rejected, test.pows, test.rejected)
+			}
+		})
+	}
+}
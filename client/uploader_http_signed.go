@@ -0,0 +1,124 @@
+package client
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ao-data/albiondata-client/log"
+	uuid "github.com/nu7hatch/gouuid"
+)
+
+// Headers sent by the signed uploader
+const (
+	signedHeaderTimestamp  = "X-Albiondata-Timestamp"
+	signedHeaderNonce      = "X-Albiondata-Nonce"
+	signedHeaderTopic      = "X-Albiondata-Topic"
+	signedHeaderIdentifier = "X-Albiondata-Identifier"
+	signedHeaderSignature  = "X-Albiondata-Signature"
+)
+
+// Where the timestamp and nonce of a signed request come from, tests fix them for a known signature
+var (
+	signedTimestamp = func() string { return strconv.FormatInt(time.Now().Unix(), 10) }
+	signedNonce     = func() (string, error) {
+		nonce, err := uuid.NewV4()
+		if err != nil {
+			return "", err
+		}
+		return nonce.String(), nil
+	}
+)
+
+// httpUploaderSigned posts payloads like httpUploader, but signs every request so the
+// receiving server can check it came from us and was not replayed.
+//
+// The signature is "sha256=" followed by the hex encoded HMAC-SHA256, keyed with the
+// configured secret, of: timestamp + "." + nonce + "." + topic + "." + body
+// Servers should reject old timestamps and nonces they have seen before.
+type httpUploaderSigned struct {
+	baseURL   string
+	secret    []byte
+	token     string
+	transport *http.Transport
+}
+
+// newHTTPUploaderSigned creates a new signed HTTP uploader for http+signed:// and https+signed:// targets
+func newHTTPUploaderSigned(url string) uploader {
+	url = strings.Replace(url, "https+signed", "https", -1)
+	url = strings.Replace(url, "http+signed", "http", -1)
+
+	if ConfigGlobal.WebhookSecret == "" && ConfigGlobal.WebhookBearerToken == "" {
+		log.Warnf("Neither webhook.secret nor webhook.bearer_token is configured, requests to %v are not authenticated", url)
+	}
+
+	return &httpUploaderSigned{
+		baseURL:   url,
+		secret:    []byte(ConfigGlobal.WebhookSecret),
+		token:     ConfigGlobal.WebhookBearerToken,
+		transport: &http.Transport{},
+	}
+}
+
+// signPayload returns the signature header value for a request
+func signPayload(secret []byte, timestamp string, nonce string, topic string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "." + nonce + "." + topic + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (u *httpUploaderSigned) sendToIngest(body []byte, topic string, state *albionState, identifier string) error {
+	client := &http.Client{Transport: u.transport}
+
+	fullURL := u.baseURL + "/" + topic
+
+	req, err := http.NewRequest("POST", fullURL, bytes.NewBuffer(body))
+	if err != nil {
+		return fmt.Errorf("error while create new request: %v", err)
+	}
+
+	nonce, err := signedNonce()
+	if err != nil {
+		return fmt.Errorf("error while creating nonce: %v", err)
+	}
+	timestamp := signedTimestamp()
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", fmt.Sprintf("albiondata-client/%v", version))
+	req.Header.Set(signedHeaderTimestamp, timestamp)
+	req.Header.Set(signedHeaderNonce, nonce)
+	req.Header.Set(signedHeaderTopic, topic)
+	req.Header.Set(signedHeaderIdentifier, identifier)
+	if len(u.secret) > 0 {
+		req.Header.Set(signedHeaderSignature, signPayload(u.secret, timestamp, nonce, topic, body))
+	}
+	if u.token != "" {
+		req.Header.Set("Authorization", "Bearer "+u.token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error while sending signed ingest with data: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// See: https://stackoverflow.com/questions/17948827/reusing-http-connections-in-golang
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return newIngestStatusError(resp.StatusCode, "got bad response code: %v", resp.StatusCode)
+	}
+
+	log.Infof("Successfully sent signed ingest request to %v", u.baseURL)
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package client
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// A request signed with a known secret, timestamp and nonce, for receivers to check their verification against
+const (
+	signedTestSecret    = "secret"
+	signedTestTimestamp = "1700000000"
+	signedTestNonce     = "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+	signedTestTopic     = "marketorders.ingest"
+	signedTestBody      = `{"Orders":[]}`
+	// HMAC-SHA256 of "1700000000.6ba7b810-9dad-11d1-80b4-00c04fd430c8.marketorders.ingest.{"Orders":[]}" keyed with "secret"
+	signedTestSignature = "sha256=7b22ac4c40e6bfdca6b3854778dc2ead75e523616dc9af5fc40c35e5f87bc52d"
+)
+
+func TestSignPayload(t *testing.T) {
+	signature := signPayload([]byte(signedTestSecret), signedTestTimestamp, signedTestNonce, signedTestTopic, []byte(signedTestBody))
+	if signature != signedTestSignature {
+		t.Errorf("got signature %v, wanted %v", signature, signedTestSignature)
+	}
+
+	// What a receiver computes from the headers and the body
+	mac := hmac.New(sha256.New, []byte(signedTestSecret))
+	mac.Write([]byte(signedTestTimestamp + "." + signedTestNonce + "." + signedTestTopic + "." + signedTestBody))
+	if expected := "sha256=" + hex.EncodeToString(mac.Sum(nil)); signature != expected {
+		t.Errorf("got signature %v, a receiver computes %v", signature, expected)
+	}
+}
+
+func TestSignedUploaderHeaders(t *testing.T) {
+	timestamp, nonce := signedTimestamp, signedNonce
+	signedTimestamp = func() string { return signedTestTimestamp }
+	signedNonce = func() (string, error) { return signedTestNonce, nil }
+	t.Cleanup(func() { signedTimestamp, signedNonce = timestamp, nonce })
+
+	tests := []struct {
+		name     string
+		secret   string
+		token    string
+		expected map[string]string
+	}{
+		{
+			name:   "secret and token",
+			secret: signedTestSecret,
+			token:  "token",
+			expected: map[string]string{
+				signedHeaderSignature: signedTestSignature,
+				"Authorization":       "Bearer token",
+			},
+		},
+		{
+			name:     "secret",
+			secret:   signedTestSecret,
+			expected: map[string]string{signedHeaderSignature: signedTestSignature, "Authorization": ""},
+		},
+		{
+			name:     "token",
+			token:    "token",
+			expected: map[string]string{signedHeaderSignature: "", "Authorization": "Bearer token"},
+		},
+		{
+			name:     "neither",
+			expected: map[string]string{signedHeaderSignature: "", "Authorization": ""},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var header http.Header
+			var path, body string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				data, _ := ioutil.ReadAll(r.Body)
+				header, path, body = r.Header, r.URL.Path, string(data)
+			}))
+			defer server.Close()
+
+			u := &httpUploaderSigned{baseURL: server.URL, secret: []byte(test.secret), token: test.token, transport: &http.Transport{}}
+			if err := u.sendToIngest([]byte(signedTestBody), signedTestTopic, &albionState{}, "identifier"); err != nil {
+				t.Fatal(err)
+			}
+
+			if path != "/"+signedTestTopic || body != signedTestBody {
+				t.Errorf("got %v with %v", path, body)
+			}
+
+			expected := map[string]string{
+				"Content-Type":         "application/json",
+				"User-Agent":           "albiondata-client/" + version,
+				signedHeaderTimestamp:  signedTestTimestamp,
+				signedHeaderNonce:      signedTestNonce,
+				signedHeaderTopic:      signedTestTopic,
+				signedHeaderIdentifier: "identifier",
+			}
+			for name, value := range test.expected {
+				expected[name] = value
+			}
+			for name, value := range expected {
+				if actual := header.Get(name); actual != value {
+					t.Errorf("header %v is %q, wanted %q", name, actual, value)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,278 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeMQTTBroker accepts connections, answers CONNECT with CONNACK and QoS 1 PUBLISH with
+// PUBACK, and hands every packet it receives to the test
+type fakeMQTTBroker struct {
+	listener net.Listener
+	packets  chan fakeMQTTPacket
+
+	// Close the connection instead of acknowledging a QoS 1 publish
+	dropOnPublish bool
+
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+type fakeMQTTPacket struct {
+	header byte
+	body   []byte
+}
+
+func newFakeMQTTBroker(t *testing.T, dropOnPublish bool) *fakeMQTTBroker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &fakeMQTTBroker{listener: listener, packets: make(chan fakeMQTTPacket, 100), dropOnPublish: dropOnPublish}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			b.mu.Lock()
+			b.conns = append(b.conns, conn)
+			b.mu.Unlock()
+			go b.serve(conn)
+		}
+	}()
+	t.Cleanup(b.close)
+	return b
+}
+
+func (b *fakeMQTTBroker) serve(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	for {
+		header, body, err := readMQTTPacket(r)
+		if err != nil {
+			return
+		}
+		b.packets <- fakeMQTTPacket{header: header, body: body}
+
+		switch header & 0xF0 {
+		case mqttConnect:
+			conn.Write([]byte{mqttConnack, 2, 0, 0})
+		case mqttPublish:
+			if (header>>1)&0x03 == 0 {
+				continue
+			}
+			if b.dropOnPublish {
+				conn.Close()
+				return
+			}
+			topicLength := int(binary.BigEndian.Uint16(body))
+			id := body[2+topicLength : 4+topicLength]
+			conn.Write([]byte{mqttPuback, 2, id[0], id[1]})
+		case mqttPingreq:
+			conn.Write([]byte{mqttPingresp, 0})
+		}
+	}
+}
+
+// dropClients closes the connections to the broker, it keeps accepting new ones
+func (b *fakeMQTTBroker) dropClients() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, conn := range b.conns {
+		conn.Close()
+	}
+	b.conns = nil
+}
+
+func (b *fakeMQTTBroker) close() {
+	b.listener.Close()
+	b.dropClients()
+}
+
+func (b *fakeMQTTBroker) target(userinfo string, query string) string {
+	return "mqtt://" + userinfo + b.listener.Addr().String() + "?" + query
+}
+
+func (b *fakeMQTTBroker) next(t *testing.T) fakeMQTTPacket {
+	t.Helper()
+	select {
+	case packet := <-b.packets:
+		return packet
+	case <-time.After(5 * time.Second):
+		t.Fatal("broker received nothing")
+		return fakeMQTTPacket{}
+	}
+}
+
+func newTestMQTTUploader(t *testing.T, target string) *mqttUploader {
+	t.Helper()
+	u, ok := newMQTTUploader(target).(*mqttUploader)
+	if !ok {
+		t.Fatalf("no uploader for %v", target)
+	}
+	return u
+}
+
+func TestMQTTConnectPacket(t *testing.T) {
+	broker := newFakeMQTTBroker(t, false)
+	u := newTestMQTTUploader(t, broker.target("user:pass@", "client_id=test-client"))
+
+	if err := u.sendToIngest([]byte("{}"), "marketorders.ingest", &albionState{}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	connect := broker.next(t)
+	if connect.header != mqttConnect {
+		t.Fatalf("first packet is %x, wanted CONNECT", connect.header)
+	}
+	expected := []byte("\x00\x04MQTT" + // protocol name
+		"\x04" + // protocol level 3.1.1
+		"\xC2" + // user name, password and clean session
+		"\x00\x1E" + // keep alive of 30 seconds
+		"\x00\x0Btest-client" +
+		"\x00\x04user" +
+		"\x00\x04pass")
+	if !bytes.Equal(connect.body, expected) {
+		t.Errorf("CONNECT is %q, wanted %q", connect.body, expected)
+	}
+}
+
+func TestMQTTPublishPacket(t *testing.T) {
+	broker := newFakeMQTTBroker(t, false)
+	u := newTestMQTTUploader(t, broker.target("", "prefix=ao/&retain=true"))
+
+	if err := u.sendToIngest([]byte(`{"Orders":[]}`), "marketorders.ingest", &albionState{}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	broker.next(t) // CONNECT
+	publish := broker.next(t)
+	if publish.header != mqttPublish|0x01 {
+		t.Errorf("PUBLISH header is %x, wanted QoS 0 with retain", publish.header)
+	}
+	expected := []byte("\x00\x16ao/marketorders/ingest" + `{"Orders":[]}`)
+	if !bytes.Equal(publish.body, expected) {
+		t.Errorf("PUBLISH is %q, wanted %q", publish.body, expected)
+	}
+}
+
+func TestMQTTPublishQoS1(t *testing.T) {
+	broker := newFakeMQTTBroker(t, false)
+	u := newTestMQTTUploader(t, broker.target("", "qos=1&prefix="))
+
+	for id := 1; id <= 2; id++ {
+		if err := u.sendToIngest([]byte("{}"), "goldprices.ingest", &albionState{}, ""); err != nil {
+			t.Fatalf("publish %d: %v", id, err)
+		}
+	}
+
+	broker.next(t) // CONNECT
+	for id := 1; id <= 2; id++ {
+		publish := broker.next(t)
+		if publish.header != mqttPublish|0x02 {
+			t.Errorf("PUBLISH header is %x, wanted QoS 1", publish.header)
+		}
+		expected := []byte("\x00\x11goldprices/ingest\x00" + string(rune(id)) + "{}")
+		if !bytes.Equal(publish.body, expected) {
+			t.Errorf("PUBLISH is %q, wanted %q", publish.body, expected)
+		}
+	}
+
+	u.mu.Lock()
+	pending := len(u.acks)
+	u.mu.Unlock()
+	if pending != 0 {
+		t.Errorf("%d acknowledgements still pending", pending)
+	}
+}
+
+func TestMQTTPublishQoS1ConnectionLost(t *testing.T) {
+	broker := newFakeMQTTBroker(t, true)
+	u := newTestMQTTUploader(t, broker.target("", "qos=1"))
+
+	err := u.sendToIngest([]byte("{}"), "goldprices.ingest", &albionState{}, "")
+	if err == nil || !strings.Contains(err.Error(), "lost") {
+		t.Errorf("publish without acknowledgement returned %v", err)
+	}
+}
+
+func TestMQTTReconnect(t *testing.T) {
+	wait := mqttReconnectWait
+	mqttReconnectWait = 0
+	defer func() { mqttReconnectWait = wait }()
+
+	broker := newFakeMQTTBroker(t, false)
+	u := newTestMQTTUploader(t, broker.target("", ""))
+
+	if err := u.sendToIngest([]byte("1"), "skills", &albionState{}, ""); err != nil {
+		t.Fatal(err)
+	}
+	broker.next(t) // CONNECT
+	broker.next(t) // PUBLISH
+
+	broker.dropClients()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		u.mu.Lock()
+		connected := u.conn != nil
+		u.mu.Unlock()
+		if !connected {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("uploader did not notice the broker dropping the connection")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := u.sendToIngest([]byte("2"), "skills", &albionState{}, ""); err != nil {
+		t.Fatalf("publish after reconnecting: %v", err)
+	}
+	if packet := broker.next(t); packet.header != mqttConnect {
+		t.Errorf("got %x after the connection was dropped, wanted CONNECT", packet.header)
+	}
+	if packet := broker.next(t); packet.header&0xF0 != mqttPublish || !bytes.HasSuffix(packet.body, []byte("2")) {
+		t.Errorf("got %x %q after reconnecting, wanted the PUBLISH", packet.header, packet.body)
+	}
+}
+
+func TestMQTTTopic(t *testing.T) {
+	u := &mqttUploader{
+		prefix: "albiondata/",
+		topics: map[string]string{"goldprices.ingest": "gold"},
+	}
+
+	tests := map[string]string{
+		"marketorders.ingest":    "albiondata/marketorders/ingest",
+		"markethistories.ingest": "albiondata/markethistories/ingest",
+		"skills":                 "albiondata/skills",
+		"goldprices.ingest":      "gold",
+	}
+	for topic, expected := range tests {
+		if mapped := u.mqttTopic(topic); mapped != expected {
+			t.Errorf("%v is mapped to %v, wanted %v", topic, mapped, expected)
+		}
+	}
+}
+
+func TestMQTTRemainingLength(t *testing.T) {
+	for _, length := range []int{0, 127, 128, 16383, 16384, 2097152} {
+		packet := mqttPacket(mqttPublish, make([]byte, length))
+
+		header, body, err := readMQTTPacket(bufio.NewReader(bytes.NewReader(packet)))
+		if err != nil {
+			t.Errorf("length %d: %v", length, err)
+			continue
+		}
+		if header != mqttPublish || len(body) != length {
+			t.Errorf("length %d was read back as %x with %d bytes", length, header, len(body))
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package client
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	nats "github.com/nats-io/go-nats"
+	"github.com/nats-io/nats-server/v2/server"
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nkeys"
+	"github.com/sirupsen/logrus"
+)
+
+// runNATSServer starts an embedded NATS server on a free port, or on the given one, until the test ends
+func runNATSServer(t *testing.T, port int, configure func(opts *server.Options)) *server.Server {
+	opts := natsserver.DefaultTestOptions
+	opts.Port = port
+	if port == 0 {
+		opts.Port = server.RANDOM_PORT
+	}
+	if configure != nil {
+		configure(&opts)
+	}
+
+	s := natsserver.RunServer(&opts)
+	t.Cleanup(s.Shutdown)
+	return s
+}
+
+func natsPort(s *server.Server) int {
+	return s.Addr().(*net.TCPAddr).Port
+}
+
+// natsSubscribe returns the messages published on subject, as received by another client
+func natsSubscribe(t *testing.T, url string, subject string, opts ...nats.Option) chan *nats.Msg {
+	nc, err := nats.Connect(url, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nc.Close)
+
+	msgs := make(chan *nats.Msg, 100)
+	if _, err := nc.ChanSubscribe(subject, msgs); err != nil {
+		t.Fatal(err)
+	}
+	if err := nc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return msgs
+}
+
+func nextNATSMsg(t *testing.T, msgs chan *nats.Msg) *nats.Msg {
+	t.Helper()
+	select {
+	case msg := <-msgs:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message published")
+		return nil
+	}
+}
+
+func shortNATSReconnectWait(t *testing.T) {
+	wait := natsReconnectWait
+	natsReconnectWait = 50 * time.Millisecond
+	t.Cleanup(func() { natsReconnectWait = wait })
+}
+
+func waitForNATS(t *testing.T, u *natsUploader, connected bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		u.mu.Lock()
+		nc := u.nc
+		u.mu.Unlock()
+		if (nc != nil && nc.IsConnected()) == connected {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("uploader connected: %v, wanted %v", !connected, connected)
+}
+
+// closeNATSUploader closes an uploader once the test ends
+func closeNATSUploader(t *testing.T, u *natsUploader) {
+	t.Cleanup(u.close)
+}
+
+func TestNATSUploaderPublishes(t *testing.T) {
+	s := runNATSServer(t, 0, nil)
+	msgs := natsSubscribe(t, s.ClientURL(), ">")
+
+	u := newNATSUploader(s.ClientURL()).(*natsUploader)
+	closeNATSUploader(t, u)
+	waitForNATS(t, u, true)
+
+	if err := u.sendToIngest([]byte(`{"Orders":[]}`), "marketorders.ingest", &albionState{}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := nextNATSMsg(t, msgs)
+	if msg.Subject != "marketorders.ingest" || string(msg.Data) != `{"Orders":[]}` || msg.Reply != "" {
+		t.Errorf("got %v %q reply %q", msg.Subject, msg.Data, msg.Reply)
+	}
+}
+
+func TestNATSUploaderAuth(t *testing.T) {
+	user, err := nkeys.CreateUser()
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed, _ := user.Seed()
+	pub, _ := user.PublicKey()
+
+	other, err := nkeys.CreateUser()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherSeed, _ := other.Seed()
+
+	tests := []struct {
+		name      string
+		configure func(opts *server.Options)
+		userinfo  string
+		query     string
+		token     string
+		connects  bool
+	}{
+		{
+			name:      "user and password in the url",
+			configure: func(opts *server.Options) { opts.Username, opts.Password = "albion", "secret" },
+			userinfo:  "albion:secret@",
+			connects:  true,
+		},
+		{
+			name:      "wrong password in the url",
+			configure: func(opts *server.Options) { opts.Username, opts.Password = "albion", "secret" },
+			userinfo:  "albion:wrong@",
+		},
+		{
+			name:      "token from the config",
+			configure: func(opts *server.Options) { opts.Authorization = "s3cr3t" },
+			token:     "s3cr3t",
+			connects:  true,
+		},
+		{
+			name:      "nkey seed",
+			configure: func(opts *server.Options) { opts.Nkeys = []*server.NkeyUser{{Nkey: pub}} },
+			query:     "nkey=" + string(seed),
+			connects:  true,
+		},
+		{
+			name:      "seed of another user",
+			configure: func(opts *server.Options) { opts.Nkeys = []*server.NkeyUser{{Nkey: pub}} },
+			query:     "nkey=" + string(otherSeed),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			shortNATSReconnectWait(t)
+			hook := captureWarnings(t)
+
+			token := ConfigGlobal.NatsToken
+			ConfigGlobal.NatsToken = test.token
+			t.Cleanup(func() { ConfigGlobal.NatsToken = token })
+
+			s := runNATSServer(t, 0, test.configure)
+			url := "nats://" + test.userinfo + s.Addr().String() + "?" + test.query
+
+			u := newNATSUploader(url).(*natsUploader)
+			closeNATSUploader(t, u)
+
+			if test.connects {
+				waitForNATS(t, u, true)
+				return
+			}
+
+			deadline := time.Now().Add(5 * time.Second)
+			for !loggedRefusal(hook.AllEntries()) {
+				if time.Now().After(deadline) {
+					t.Fatal("server did not refuse the connection")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			waitForNATS(t, u, false)
+		})
+	}
+}
+
+func loggedRefusal(entries []*logrus.Entry) bool {
+	for _, entry := range entries {
+		if strings.Contains(entry.Message, "Could not connect to NATS server") && strings.Contains(strings.ToLower(entry.Message), "authorization violation") {
+			return true
+		}
+	}
+	return false
+}
+
+func TestNATSUploaderRejectsInvalidNkeySeed(t *testing.T) {
+	if u := newNATSUploader("nats://127.0.0.1:4222?nkey=not-a-seed"); u != nil {
+		t.Error("created an uploader with an invalid nkey seed")
+	}
+}
+
+func TestNATSUploaderBuffersUntilFirstConnect(t *testing.T) {
+	shortNATSReconnectWait(t)
+
+	// Find a free port, nothing listens on it until the server is started below
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	u := newNATSUploader("nats://127.0.0.1:" + strconv.Itoa(port) + "?buffer_size=2").(*natsUploader)
+	closeNATSUploader(t, u)
+	for i := 0; i < 2; i++ {
+		if err := u.sendToIngest([]byte(strconv.Itoa(i)), "skills", &albionState{}, ""); err != nil {
+			t.Fatalf("message %d was not buffered: %v", i, err)
+		}
+	}
+	if err := u.sendToIngest([]byte("2"), "skills", &albionState{}, ""); err == nil {
+		t.Error("no error once the buffer is full")
+	}
+
+	// Holding the uploader back until the subscriber is there, so the buffer is not sent before
+	u.mu.Lock()
+	s := runNATSServer(t, port, nil)
+	msgs := natsSubscribe(t, s.ClientURL(), "skills")
+	u.mu.Unlock()
+
+	for i := 0; i < 2; i++ {
+		if msg := nextNATSMsg(t, msgs); string(msg.Data) != strconv.Itoa(i) {
+			t.Errorf("buffered message %d is %q", i, msg.Data)
+		}
+	}
+}
+
+func TestNATSUploaderReconnects(t *testing.T) {
+	shortNATSReconnectWait(t)
+
+	s := runNATSServer(t, 0, nil)
+	port := natsPort(s)
+
+	u := newNATSUploader(s.ClientURL()).(*natsUploader)
+	closeNATSUploader(t, u)
+	waitForNATS(t, u, true)
+
+	s.Shutdown()
+	waitForNATS(t, u, false)
+
+	if err := u.sendToIngest([]byte("while away"), "goldprices.ingest", &albionState{}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	u.mu.Lock()
+	s = runNATSServer(t, port, nil)
+	msgs := natsSubscribe(t, s.ClientURL(), "goldprices.ingest")
+	u.mu.Unlock()
+
+	if msg := nextNATSMsg(t, msgs); string(msg.Data) != "while away" {
+		t.Errorf("got %q after reconnecting", msg.Data)
+	}
+	waitForNATS(t, u, true)
+}
+
+func TestNATSUploaderJetStreamAck(t *testing.T) {
+	s := runNATSServer(t, 0, func(opts *server.Options) {
+		opts.JetStream = true
+		opts.StoreDir = t.TempDir()
+	})
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	stream := `{"name":"MARKET","subjects":["marketorders.ingest"],"retention":"limits","discard":"old","storage":"memory","num_replicas":1,"max_consumers":-1,"max_msgs":-1,"max_bytes":-1,"max_age":0,"max_msg_size":64}`
+	reply, err := nc.Request("$JS.API.STREAM.CREATE.MARKET", []byte(stream), 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(reply.Data), `"error"`) {
+		t.Fatalf("could not create stream: %s", reply.Data)
+	}
+
+	u := newNATSUploader(s.ClientURL() + "?ack=true&ack_timeout=2s").(*natsUploader)
+	closeNATSUploader(t, u)
+	waitForNATS(t, u, true)
+
+	if err := u.sendToIngest([]byte("{}"), "marketorders.ingest", &albionState{}, ""); err != nil {
+		t.Errorf("message stored by the stream failed: %v", err)
+	}
+
+	err = u.sendToIngest([]byte(`{"Orders":[`+strings.Repeat(`{},`, 30)+`{}]}`), "marketorders.ingest", &albionState{}, "")
+	if err == nil || !strings.Contains(err.Error(), "message size exceeds maximum allowed") {
+		t.Fatalf("message rejected by the stream returned %v", err)
+	}
+	if retryableUpload(err) {
+		t.Error("a message the stream rejects for its size is retried")
+	}
+}
+
+func TestNATSUploaderAckTimeout(t *testing.T) {
+	s := runNATSServer(t, 0, nil)
+
+	u := newNATSUploader(s.ClientURL() + "?ack=true&ack_timeout=100ms").(*natsUploader)
+	closeNATSUploader(t, u)
+	waitForNATS(t, u, true)
+
+	if err := u.sendToIngest([]byte("{}"), "marketorders.ingest", &albionState{}, ""); err == nil {
+		t.Error("no error without an acknowledgement")
+	}
+}
@@ -0,0 +1,81 @@
+package client
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/ao-data/albiondata-client/log"
+)
+
+// Uploads waiting for a target before further ones are turned away
+const uploadQueueSize = 100
+
+var (
+	uploadQueuesMu sync.Mutex
+	uploadQueues   = make(map[string]*uploadQueue)
+)
+
+// uploadQueue hands the uploads of a target to a worker of its own, so a slow or unreachable
+// target (e.g. solving a pow) can't hold up capturing or the other targets. A single worker
+// keeps the uploads of a target in the order they were captured.
+type uploadQueue struct {
+	target string
+	jobs   chan *uploadJob
+
+	// Uploads queued and not sent yet
+	pending sync.WaitGroup
+}
+
+type uploadJob struct {
+	next       uploader
+	body       []byte
+	topic      string
+	state      *albionState
+	identifier string
+}
+
+// queuedUploader queues uploads for next on the queue of its target
+type queuedUploader struct {
+	queue *uploadQueue
+	next  uploader
+}
+
+// getUploadQueue returns an uploader that queues the uploads for next, on a queue
+// shared by every upload to the target
+func getUploadQueue(target string, next uploader) uploader {
+	uploadQueuesMu.Lock()
+	defer uploadQueuesMu.Unlock()
+
+	q, ok := uploadQueues[target]
+	if !ok {
+		q = &uploadQueue{target: target, jobs: make(chan *uploadJob, uploadQueueSize)}
+		go q.run()
+		uploadQueues[target] = q
+	}
+
+	return &queuedUploader{queue: q, next: next}
+}
+
+// sendToIngest never waits for the target. An upload that finds the queue full is returned
+// as an error, for the spool in front of the queue to keep.
+func (u *queuedUploader) sendToIngest(body []byte, topic string, state *albionState, identifier string) error {
+	job := &uploadJob{next: u.next, body: body, topic: topic, state: state, identifier: identifier}
+
+	u.queue.pending.Add(1)
+	select {
+	case u.queue.jobs <- job:
+		return nil
+	default:
+		u.queue.pending.Done()
+		return fmt.Errorf("uploads to %v do not keep up, %d are waiting already", u.queue.target, uploadQueueSize)
+	}
+}
+
+func (q *uploadQueue) run() {
+	for job := range q.jobs {
+		if err := job.next.sendToIngest(job.body, job.topic, job.state, job.identifier); err != nil {
+			log.Errorf("Error while sending %v to ingest: %v", job.topic, err)
+		}
+		q.pending.Done()
+	}
+}
@@ -0,0 +1,190 @@
+package client
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ao-data/albiondata-client/db"
+	"github.com/ao-data/albiondata-client/log"
+)
+
+const (
+	// How often the spool is checked for uploads that are due for a retry
+	spoolRetryInterval = 5 * time.Second
+
+	// Backoff after the first failed attempt, doubled for every further failure
+	spoolMinBackoff = 5 * time.Second
+
+	// Maximum number of uploads retried per check
+	spoolBatchSize = 50
+)
+
+var uploadSpool *uploaderSpool
+
+// uploaderSpool keeps uploads that failed on disk and retries them with exponential backoff
+// until they are delivered or older than ConfigGlobal.SpoolMaxAge
+type uploaderSpool struct {
+	store     *db.Spool
+	lastDepth int
+}
+
+func openUploadSpool(path string) error {
+	store, err := db.OpenSpool(path)
+	if err != nil {
+		return err
+	}
+
+	uploadSpool = &uploaderSpool{store: store, lastDepth: -1}
+	return nil
+}
+
+// UploadQueueDepth returns the number of uploads waiting in the spool
+func UploadQueueDepth() int {
+	if uploadSpool == nil {
+		return 0
+	}
+
+	depth, err := uploadSpool.store.Depth()
+	if err != nil {
+		log.Debugf("Could not read upload spool depth: %v", err)
+		return 0
+	}
+	return depth
+}
+
+func (s *uploaderSpool) push(target string, body []byte, topic string, state *albionState, identifier string) error {
+	return s.store.Push(&db.SpoolEntry{
+		Target:        target,
+		Topic:         topic,
+		Body:          body,
+		ServerID:      state.AODataServerID,
+		Identifier:    identifier,
+		Attempts:      1,
+		NextAttemptAt: time.Now().Add(spoolBackoff(1)),
+		CreatedAt:     state.CapturedAt,
+	})
+}
+
+func (s *uploaderSpool) run() {
+	// Replay whatever was left over from the last run straight away
+	s.retryDue()
+
+	ticker := time.NewTicker(spoolRetryInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.retryDue()
+	}
+}
+
+func (s *uploaderSpool) retryDue() {
+	pruned, err := s.store.Prune(time.Now().Add(-ConfigGlobal.SpoolMaxAge))
+	if err != nil {
+		log.Errorf("Could not prune upload spool: %v", err)
+	} else if pruned > 0 {
+		log.Warnf("Dropped %d spooled uploads older than %v", pruned, ConfigGlobal.SpoolMaxAge)
+	}
+
+	entries, err := s.store.Due(time.Now(), spoolBatchSize)
+	if err != nil {
+		log.Errorf("Could not read upload spool: %v", err)
+		return
+	}
+
+	// Once a target fails, leave the rest of its uploads alone until the next check
+	failedTargets := make(map[string]bool)
+
+	for _, entry := range entries {
+		if failedTargets[entry.Target] {
+			continue
+		}
+
+		u := getUploader(entry.Target)
+		if u == nil {
+			log.Warnf("Dropping spooled upload for invalid ingest target: %v", entry.Target)
+			s.delete(entry)
+			continue
+		}
+
+		state := &albionState{AODataServerID: entry.ServerID, CapturedAt: entry.CreatedAt.UTC()}
+		err := u.sendToIngest(entry.Body, entry.Topic, state, entry.Identifier)
+		if err != nil && !retryableUpload(err) {
+			log.Warnf("Dropping spooled %v upload the ingest refused: %v", entry.Topic, err)
+			s.delete(entry)
+			continue
+		}
+		if err != nil {
+			failedTargets[entry.Target] = true
+
+			attempts := entry.Attempts + 1
+			backoff := spoolBackoff(attempts)
+			log.Debugf("Retry %d of spooled %v upload failed, next attempt in %v: %v", attempts, entry.Topic, backoff, err)
+
+			err = s.store.Reschedule(entry.ID, attempts, time.Now().Add(backoff))
+			if err != nil {
+				log.Errorf("Could not reschedule spooled upload: %v", err)
+			}
+			continue
+		}
+
+		log.Infof("Delivered spooled %v upload (Identifier: %s)", entry.Topic, entry.Identifier)
+		s.delete(entry)
+	}
+
+	s.logDepth()
+}
+
+func (s *uploaderSpool) delete(entry *db.SpoolEntry) {
+	if err := s.store.Delete(entry.ID); err != nil {
+		log.Errorf("Could not remove upload from spool: %v", err)
+	}
+}
+
+func (s *uploaderSpool) logDepth() {
+	depth, err := s.store.Depth()
+	if err != nil || depth == s.lastDepth {
+		return
+	}
+
+	if depth > 0 {
+		log.Infof("Upload spool depth: %d", depth)
+	} else if s.lastDepth > 0 {
+		log.Info("Upload spool drained")
+	}
+	s.lastDepth = depth
+}
+
+// spoolBackoff returns how long to wait before the next attempt after the given number of attempts
+func spoolBackoff(attempts int) time.Duration {
+	backoff := spoolMinBackoff
+	for i := 1; i < attempts && backoff < ConfigGlobal.SpoolMaxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > ConfigGlobal.SpoolMaxBackoff {
+		backoff = ConfigGlobal.SpoolMaxBackoff
+	}
+	return backoff
+}
+
+// spooledUploader hands uploads that failed for a reason that may go away to the spool
+// instead of dropping them
+type spooledUploader struct {
+	target string
+	next   uploader
+	spool  *uploaderSpool
+}
+
+func (u *spooledUploader) sendToIngest(body []byte, topic string, state *albionState, identifier string) error {
+	err := u.next.sendToIngest(body, topic, state, identifier)
+	if err == nil || !retryableUpload(err) {
+		return err
+	}
+
+	if spoolErr := u.spool.push(u.target, body, topic, state, identifier); spoolErr != nil {
+		return fmt.Errorf("%v (could not spool upload: %v)", err, spoolErr)
+	}
+
+	log.Warnf("Upload of %v to %v failed, spooled for retry: %v", topic, u.target, err)
+	return nil
+}
@@ -0,0 +1,202 @@
+package client
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ao-data/albiondata-client/db"
+)
+
+// useTestSpool opens a spool in a temporary directory as the upload spool while the test runs
+func useTestSpool(t *testing.T) *uploaderSpool {
+	store, err := db.OpenSpool(filepath.Join(t.TempDir(), "spool.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spool, maxAge := uploadSpool, ConfigGlobal.SpoolMaxAge
+	uploadSpool = &uploaderSpool{store: store, lastDepth: -1}
+	ConfigGlobal.SpoolMaxAge = time.Hour
+	t.Cleanup(func() {
+		store.Close()
+		uploadSpool, ConfigGlobal.SpoolMaxAge = spool, maxAge
+	})
+
+	return uploadSpool
+}
+
+// failingUploader fails every upload with err
+type failingUploader struct {
+	err error
+}
+
+func (u *failingUploader) sendToIngest(body []byte, topic string, state *albionState, identifier string) error {
+	return u.err
+}
+
+// blockingUploader holds every upload until release is closed
+type blockingUploader struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (u *blockingUploader) sendToIngest(body []byte, topic string, state *albionState, identifier string) error {
+	select {
+	case u.started <- struct{}{}:
+	default:
+	}
+	<-u.release
+	return nil
+}
+
+func spoolDepth(t *testing.T, spool *uploaderSpool) int {
+	depth, err := spool.store.Depth()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return depth
+}
+
+func TestSpooledUploaderKeepsRetryableErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		spooled bool
+	}{
+		{name: "network error", err: errors.New("error while sending ingest with data: connection refused"), spooled: true},
+		{name: "too many requests", err: newIngestStatusError(429, "got bad response code: 429"), spooled: true},
+		{name: "server error", err: newIngestStatusError(503, "got bad response code: 503"), spooled: true},
+		{name: "bad request", err: newIngestStatusError(400, "got bad response code: 400")},
+		{name: "unauthorized", err: newIngestStatusError(401, "got bad response code: 401")},
+		{name: "forbidden", err: newIngestStatusError(403, "got bad response code: 403")},
+		{name: "too large", err: newIngestStatusError(413, "got bad response code: 413")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			spool := useTestSpool(t)
+			u := &spooledUploader{target: "http://ingest", next: &failingUploader{err: test.err}, spool: spool}
+
+			err := u.sendToIngest([]byte(`{}`), "marketorders.ingest", &albionState{AODataServerID: 1}, "id")
+
+			if test.spooled {
+				if err != nil {
+					t.Errorf("got error %v, wanted the upload spooled", err)
+				}
+				if depth := spoolDepth(t, spool); depth != 1 {
+					t.Errorf("spool holds %d uploads, wanted 1", depth)
+				}
+				return
+			}
+
+			if err != test.err {
+				t.Errorf("got error %v, wanted %v", err, test.err)
+			}
+			if depth := spoolDepth(t, spool); depth != 0 {
+				t.Errorf("spool holds %d uploads of a permanent failure", depth)
+			}
+		})
+	}
+}
+
+func TestUploadQueueOverflowIsSpooled(t *testing.T) {
+	spool := useTestSpool(t)
+
+	const target = "blocking://overflow"
+	blocking := &blockingUploader{started: make(chan struct{}, 1), release: make(chan struct{})}
+	uploaderCacheMu.Lock()
+	uploaderCache[target] = blocking
+	uploaderCacheMu.Unlock()
+	t.Cleanup(func() {
+		uploaderCacheMu.Lock()
+		delete(uploaderCache, target)
+		uploaderCacheMu.Unlock()
+	})
+
+	state := &albionState{AODataServerID: 1}
+	send := func() {
+		uploaders := createUploaders([]string{target}, "marketorders.ingest", state)
+		if len(uploaders) != 1 {
+			t.Fatalf("got %d uploaders for %v", len(uploaders), target)
+		}
+		if err := uploaders[0].sendToIngest([]byte(`{}`), "marketorders.ingest", state, "id"); err != nil {
+			t.Fatalf("upload failed instead of being spooled: %v", err)
+		}
+	}
+
+	// The first upload keeps the worker busy, the next ones fill the queue
+	send()
+	<-blocking.started
+	for i := 0; i < uploadQueueSize; i++ {
+		send()
+	}
+	if depth := spoolDepth(t, spool); depth != 0 {
+		t.Fatalf("spool holds %d uploads before the queue is full", depth)
+	}
+
+	const overflow = 3
+	for i := 0; i < overflow; i++ {
+		send()
+	}
+	if depth := spoolDepth(t, spool); depth != overflow {
+		t.Errorf("spool holds %d uploads, wanted the %d the full queue turned away", depth, overflow)
+	}
+
+	close(blocking.release)
+	uploadQueuesMu.Lock()
+	q := uploadQueues[target]
+	uploadQueuesMu.Unlock()
+	q.pending.Wait()
+}
+
+// recordingUploader keeps the state of every upload it is given
+type recordingUploader struct {
+	mu     sync.Mutex
+	states []albionState
+}
+
+func (u *recordingUploader) sendToIngest(body []byte, topic string, state *albionState, identifier string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.states = append(u.states, *state)
+	return nil
+}
+
+func TestSpoolReplayKeepsCaptureTime(t *testing.T) {
+	spool := useTestSpool(t)
+
+	const target = "recording://spool"
+	recording := &recordingUploader{}
+	uploaderCacheMu.Lock()
+	uploaderCache[target] = recording
+	uploaderCacheMu.Unlock()
+	t.Cleanup(func() {
+		uploaderCacheMu.Lock()
+		delete(uploaderCache, target)
+		uploaderCacheMu.Unlock()
+	})
+
+	// Due right away, as the backoff is capped at SpoolMaxBackoff
+	maxBackoff := ConfigGlobal.SpoolMaxBackoff
+	ConfigGlobal.SpoolMaxBackoff = 0
+	t.Cleanup(func() { ConfigGlobal.SpoolMaxBackoff = maxBackoff })
+
+	capturedAt := time.Now().UTC().Add(-time.Minute)
+	u := &spooledUploader{target: target, next: &failingUploader{err: errors.New("connection refused")}, spool: spool}
+	if err := u.sendToIngest([]byte(`{}`), "goldprices.ingest", &albionState{AODataServerID: 1, CapturedAt: capturedAt}, "id"); err != nil {
+		t.Fatal(err)
+	}
+
+	spool.retryDue()
+
+	if len(recording.states) != 1 {
+		t.Fatalf("replayed %d uploads", len(recording.states))
+	}
+	if state := recording.states[0]; !state.CapturedAt.Equal(capturedAt) || state.AODataServerID != 1 {
+		t.Errorf("replayed with server %d captured at %v, wanted %v", state.AODataServerID, state.CapturedAt, capturedAt)
+	}
+}
@@ -0,0 +1,88 @@
+package client
+
+import (
+	"sort"
+	"time"
+)
+
+// wsBacklog keeps the last messages of every topic so clients that (re)connect can catch up.
+// A topic keeps at most size messages, and none older than maxAge if it is set.
+type wsBacklog struct {
+	size   int
+	maxAge time.Duration
+	topics map[string][]*wsMessage
+}
+
+func newWSBacklog(size int, maxAge time.Duration) *wsBacklog {
+	return &wsBacklog{
+		size:   size,
+		maxAge: maxAge,
+		topics: make(map[string][]*wsMessage),
+	}
+}
+
+func (b *wsBacklog) add(m *wsMessage) {
+	if b.size <= 0 {
+		return
+	}
+
+	messages := append(b.topics[m.topic], m)
+	if len(messages) > b.size {
+		messages = append(messages[:0:0], messages[len(messages)-b.size:]...)
+	}
+	b.topics[m.topic] = messages
+
+	b.prune(m.at)
+}
+
+// since returns the messages with an id after afterID that were broadcast at or after the
+// given time, oldest first
+func (b *wsBacklog) since(afterID uint64, after time.Time) []*wsMessage {
+	b.prune(time.Now())
+
+	var result []*wsMessage
+	for _, messages := range b.topics {
+		for _, m := range messages {
+			if m.id > afterID && !m.at.Before(after) {
+				result = append(result, m)
+			}
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].id < result[j].id })
+	return result
+}
+
+// prune drops the messages that are older than maxAge
+func (b *wsBacklog) prune(now time.Time) {
+	if b.maxAge <= 0 {
+		return
+	}
+
+	cutoff := now.Add(-b.maxAge)
+	for topic, messages := range b.topics {
+		i := 0
+		for i < len(messages) && messages[i].at.Before(cutoff) {
+			i++
+		}
+		if i == len(messages) {
+			delete(b.topics, topic)
+		} else if i > 0 {
+			b.topics[topic] = messages[i:]
+		}
+	}
+}
+
+// wsReplay is what a client asks to catch up on
+type wsReplay struct {
+	// Only messages after this id, ids newer than the last broadcast are from before a restart
+	afterID uint64
+	// Only messages broadcast since then
+	after time.Time
+	// Only these topics, on top of the client's subscription
+	topics []string
+}
+
+func (r *wsReplay) matches(m *wsMessage) bool {
+	return len(r.topics) == 0 || containsString(r.topics, m.topic) || containsString(r.topics, "*")
+}
@@ -5,8 +5,10 @@
 package client
 
 import (
+	"encoding/json"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -24,7 +26,10 @@ const (
 	pingPeriod = (pongWait * 9) / 10
 
 	// Maximum message size allowed from peer.
-	maxMessageSize = 512
+	maxMessageSize = 4096
+
+	// Maximum number of queries a client can have running at once.
+	maxQueriesPerClient = 2
 )
 
 var (
@@ -35,22 +40,29 @@ var (
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		var originHost string
-		var originHostname string
-		originHost = r.Header.Get("Origin")
-
-		if originHost != "null" {
-			originHostname = (strings.Split((strings.Split(originHost, "//")[1]), ":")[0])
-			for _, v := range ConfigGlobal.AllowedWSHosts {
-				if v == originHostname {
-					return true
-				}
+	CheckOrigin:     checkOrigin,
+}
+
+// checkOrigin allows requests from the hosts in AllowedWebsocketHosts
+func checkOrigin(r *http.Request) bool {
+	var originHost string
+	var originHostname string
+	originHost = r.Header.Get("Origin")
+
+	if originHost != "null" {
+		parts := strings.SplitN(originHost, "//", 2)
+		if len(parts) < 2 {
+			return false
+		}
+		originHostname = strings.Split(parts[1], ":")[0]
+		for _, v := range ConfigGlobal.AllowedWSHosts {
+			if v == originHostname {
+				return true
 			}
 		}
+	}
 
-		return false
-	},
+	return false
 }
 
 // WSClient is a middleman between the websocket connection and the hub.
@@ -62,6 +74,12 @@ type WSClient struct {
 
 	// Buffered channel of outbound messages.
 	send chan []byte
+
+	// Topics and filters the client asked for, only used by the hub.
+	subscription *wsSubscription
+
+	// Slots for running queries, holds maxQueriesPerClient at most.
+	queries chan struct{}
 }
 
 // readPump pumps messages from the websocket connection to the hub.
@@ -80,16 +98,53 @@ func (c *WSClient) readPump() {
 	c.conn.SetPongHandler(func(string) error { c.conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
 
 	for {
-		_, _, err := c.conn.ReadMessage()
+		_, message, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway) {
 				log.Printf("error: %v", err)
 			}
 			break
 		}
+
+		req := &wsRequest{}
+		if err := json.Unmarshal(message, req); err != nil {
+			log.Printf("invalid websocket request: %v", err)
+			continue
+		}
+
+		if req.Action == "query" {
+			// Queries can take a while, so they are answered without holding up the hub.
+			// A client can only have a few running, so it can't flood the local database.
+			select {
+			case c.queries <- struct{}{}:
+				go func() {
+					defer func() { <-c.queries }()
+					c.query(req)
+				}()
+			default:
+				c.reply(&wsQueryResponse{ID: req.ID, Action: req.Action, Query: req.Query, Error: "too many queries in progress"})
+			}
+			continue
+		}
+		c.hub.requests <- &wsClientRequest{client: c, request: req}
 	}
 }
 
+// query answers a query request from the local database
+func (c *WSClient) query(req *wsRequest) {
+	c.reply(runWSQuery(req))
+}
+
+// reply sends the answer to a query to the client
+func (c *WSClient) reply(resp *wsQueryResponse) {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		log.Printf("error while encoding websocket query result: %v", err)
+		return
+	}
+	c.hub.replies <- &wsClientReply{client: c, message: data}
+}
+
 // writePump pumps messages from the hub to the websocket connection.
 //
 // A goroutine running writePump is started for each connection. The
@@ -143,11 +198,18 @@ func serveWs(hub *WSHub, w http.ResponseWriter, r *http.Request) {
 		log.Println(err)
 		return
 	}
-	client := &WSClient{hub: hub, conn: conn, send: make(chan []byte, 256)}
+	client := &WSClient{hub: hub, conn: conn, send: make(chan []byte, 256), subscription: subscriptionFromQuery(r), queries: make(chan struct{}, maxQueriesPerClient)}
 	client.hub.register <- client
 
 	// Allow collection of memory referenced by the caller by doing all work in
-	// new goroutines.
+	// new goroutines. The writer is started first so it drains a replay right away.
 	go client.writePump()
+
+	// Clients can ask for the backlog when connecting, with /ws?since=10m or /ws?replay=true
+	query := r.URL.Query()
+	if all, _ := strconv.ParseBool(query.Get("replay")); all || query.Get("since") != "" {
+		client.hub.requests <- &wsClientRequest{client: client, request: &wsRequest{Action: "replay", Since: query.Get("since")}}
+	}
+
 	go client.readPump()
 }
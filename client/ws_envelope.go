@@ -0,0 +1,79 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ao-data/albiondata-client/lib"
+	"github.com/ao-data/albiondata-client/log"
+)
+
+// wsEnvelope wraps every message sent to websocket and Server-Sent Events clients.
+// The data is described by lib.Schema(topic), in the version given by SchemaVersion.
+type wsEnvelope struct {
+	Topic         string          `json:"topic"`
+	SchemaVersion int             `json:"schema_version"`
+	Realm         string          `json:"realm,omitempty"`
+	ServerID      int             `json:"server_id"`
+	Location      string          `json:"location,omitempty"`
+	CharacterID   lib.CharacterID `json:"character_id,omitempty"`
+	Character     string          `json:"character,omitempty"`
+	Identifier    string          `json:"identifier,omitempty"`
+	CapturedAt    time.Time       `json:"captured_at"`
+	Data          json.RawMessage `json:"data"`
+}
+
+// newWSEnvelope wraps a payload, the character is only included for private topics
+func newWSEnvelope(data []byte, topic string, state *albionState, identifier string, private bool) *wsEnvelope {
+	capturedAt := state.CapturedAt
+	if capturedAt.IsZero() {
+		capturedAt = time.Now().UTC()
+	}
+
+	envelope := &wsEnvelope{
+		Topic:         topic,
+		SchemaVersion: lib.SchemaVersions[topic],
+		Realm:         realmName(state.AODataServerID),
+		ServerID:      state.AODataServerID,
+		Location:      state.LocationId,
+		Identifier:    identifier,
+		CapturedAt:    capturedAt,
+		Data:          data,
+	}
+
+	if private {
+		envelope.CharacterID = state.CharacterId
+		envelope.Character = state.CharacterName
+	}
+
+	return envelope
+}
+
+// serveSchema serves the JSON Schemas of the envelope and of the topic payloads, e.g. /schema/marketorders.ingest.json
+// /schema/ itself lists the available schemas along with their versions.
+func serveSchema(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/schema/"), ".json")
+
+	if name == "" {
+		versions := map[string]int{"envelope": lib.EnvelopeSchemaVersion}
+		for topic, v := range lib.SchemaVersions {
+			versions[topic] = v
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(versions); err != nil {
+			log.Debugf("Error while writing schema index: %v", err)
+		}
+		return
+	}
+
+	schema, err := lib.Schema(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.Write(schema)
+}
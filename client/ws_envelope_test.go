@@ -0,0 +1,235 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ao-data/albiondata-client/lib"
+)
+
+// jsonSchema is the part of JSON Schema the schemas in lib/schema use
+type jsonSchema struct {
+	Type       interface{}            `json:"type"`
+	Required   []string               `json:"required"`
+	Properties map[string]*jsonSchema `json:"properties"`
+	Items      *jsonSchema            `json:"items"`
+	Enum       []interface{}          `json:"enum"`
+	Minimum    *float64               `json:"minimum"`
+	Maximum    *float64               `json:"maximum"`
+}
+
+func loadSchema(t *testing.T, name string) *jsonSchema {
+	data, err := lib.Schema(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := &jsonSchema{}
+	if err := json.Unmarshal(data, schema); err != nil {
+		t.Fatalf("%v: %v", name, err)
+	}
+	return schema
+}
+
+// validateJSON returns the first way data does not match the schema
+func validateJSON(schema *jsonSchema, data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return err
+	}
+	return schema.validate("$", value)
+}
+
+func (s *jsonSchema) validate(path string, value interface{}) error {
+	if !s.allowsType(jsonType(value)) {
+		return fmt.Errorf("%v is %v, wanted %v", path, jsonType(value), s.Type)
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, allowed := range s.Enum {
+			if fmt.Sprint(allowed) == fmt.Sprint(value) {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("%v is %v, wanted one of %v", path, value, s.Enum)
+		}
+	}
+
+	switch v := value.(type) {
+	case json.Number:
+		n, _ := v.Float64()
+		if s.Minimum != nil && n < *s.Minimum {
+			return fmt.Errorf("%v is %v, below %v", path, n, *s.Minimum)
+		}
+		if s.Maximum != nil && n > *s.Maximum {
+			return fmt.Errorf("%v is %v, above %v", path, n, *s.Maximum)
+		}
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				return fmt.Errorf("%v has no %v", path, name)
+			}
+		}
+		for name, property := range s.Properties {
+			if field, ok := v[name]; ok {
+				if err := property.validate(path+"."+name, field); err != nil {
+					return err
+				}
+			}
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range v {
+				if err := s.Items.validate(fmt.Sprintf("%v[%d]", path, i), item); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (s *jsonSchema) allowsType(actual string) bool {
+	var types []interface{}
+	switch t := s.Type.(type) {
+	case nil:
+		return true
+	case string:
+		types = []interface{}{t}
+	case []interface{}:
+		types = t
+	}
+
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// Uploads as the operations make them, including the ones with nothing in their slices
+var schemaUploads = map[string][]interface{}{
+	lib.NatsMarketOrdersIngest: {
+		lib.MarketUpload{},
+		lib.MarketUpload{Orders: []*lib.MarketOrder{{ID: 1, ItemID: "T4_BAG", LocationID: "3005", QualityLevel: 1, Price: 1000, Amount: 2, AuctionType: "offer", Expires: "2024-03-01T12:00:00"}}},
+	},
+	lib.NatsMarketHistoriesIngest: {
+		lib.MarketHistoriesUpload{AlbionId: 1234, LocationId: "3005", QualityLevel: 1, Timescale: lib.Days},
+		lib.MarketHistoriesUpload{AlbionId: 1234, LocationId: "3005", QualityLevel: 1, Histories: []*lib.MarketHistory{{ItemAmount: 5, SilverAmount: 5000, Timestamp: 638000000000000000}}},
+	},
+	lib.NatsGoldPricesIngest: {
+		lib.GoldPricesUpload{},
+		lib.GoldPricesUpload{Prices: []int{4000}, TimeStamps: []int64{638000000000000000}},
+	},
+	lib.NatsMapDataIngest: {
+		lib.MapDataUpload{ZoneID: 1000},
+		lib.MapDataUpload{ZoneID: 1000, BuildingType: []int{1}, AvailableFood: []int{2}, Reward: []int{3}, AvailableSilver: []int{4}, Owners: []string{"guild"}, PublicFee: []int{5}, AssociateFee: []int{6}, Coordinates: [][]int{{1, 2}, nil}, Durability: []int{7}, Permission: []int{8}},
+	},
+	lib.NatsSkillData: {
+		lib.SkillsUpload{PrivateUpload: lib.PrivateUpload{CharacterId: "id", CharacterName: "Trader"}},
+		lib.SkillsUpload{PrivateUpload: lib.PrivateUpload{CharacterId: "id", CharacterName: "Trader"}, Skills: []*lib.Skill{{ID: 1, Level: 100, PercentNextLevel: 0.5, Fame: 10}}},
+	},
+	lib.NatsMarketNotifications: {
+		lib.MarketNotificationUpload{Type: lib.SalesNotification, Notification: &lib.MarketSellNotification{MailID: 1, ItemID: "T4_BAG", LocationID: "3005", Amount: 1, Price: 1000, TotalAfterTaxes: 970}},
+		lib.MarketNotificationUpload{Type: lib.ExpiryNotification, Notification: &lib.MarketExpiryNotification{MailID: 2, ItemID: "T4_BAG", LocationID: "3005", Amount: 2, Price: 1000, Sold: 1}},
+	},
+}
+
+func TestUploadsMatchSchemas(t *testing.T) {
+	envelopeSchema := loadSchema(t, "envelope")
+
+	for topic := range lib.SchemaVersions {
+		uploads := schemaUploads[topic]
+		if len(uploads) == 0 {
+			t.Errorf("no uploads of %v to validate", topic)
+			continue
+		}
+
+		schema := loadSchema(t, topic)
+		for i, upload := range uploads {
+			data, err := json.Marshal(upload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := validateJSON(schema, data); err != nil {
+				t.Errorf("upload %d of %v does not match its schema: %v\n%s", i, topic, err, data)
+			}
+
+			state := &albionState{AODataServerID: 1, LocationId: "3005", CharacterId: "id", CharacterName: "Trader"}
+			envelope, err := json.Marshal(newWSEnvelope(data, topic, state, "identifier", true))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := validateJSON(envelopeSchema, envelope); err != nil {
+				t.Errorf("envelope of upload %d of %v does not match its schema: %v\n%s", i, topic, err, envelope)
+			}
+		}
+	}
+}
+
+func TestGoldenUploadsMatchSchemas(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.golden.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var records []goldenRecord
+		if err := json.Unmarshal(data, &records); err != nil {
+			t.Fatalf("%v: %v", file, err)
+		}
+
+		for i, record := range records {
+			if _, ok := lib.SchemaVersions[record.Topic]; !ok || record.Target == "database" {
+				continue
+			}
+			if err := validateJSON(loadSchema(t, record.Topic), record.Payload); err != nil {
+				t.Errorf("record %d of %v does not match the schema of %v: %v", i, file, record.Topic, err)
+			}
+		}
+	}
+}
+
+func TestEnvelopeCapturedAt(t *testing.T) {
+	ctx := newEventContext(&albionState{AODataServerID: 1})
+	time.Sleep(time.Millisecond)
+
+	envelope := newWSEnvelope([]byte(`{}`), lib.NatsGoldPricesIngest, &ctx.state, ctx.Identifier, false)
+	if !envelope.CapturedAt.Equal(ctx.CapturedAt) {
+		t.Errorf("envelope captured at %v, wanted the capture time of the event %v", envelope.CapturedAt, ctx.CapturedAt)
+	}
+}
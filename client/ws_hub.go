@@ -4,6 +4,12 @@
 
 package client
 
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
+
 // WSHub maintains the set of active clients and broadcasts messages to the
 // clients.
 type WSHub struct {
@@ -11,21 +17,59 @@ type WSHub struct {
 	clients map[*WSClient]bool
 
 	// Inbound messages from the clients.
-	broadcast chan []byte
+	broadcast chan *wsMessage
+
+	// Requests sent by the clients.
+	requests chan *wsClientRequest
+
+	// Answers to queries, sent to the client that asked.
+	replies chan *wsClientReply
 
 	// Register requests from the clients.
 	register chan *WSClient
 
 	// Unregister requests from clients.
 	unregister chan *WSClient
+
+	// Server-Sent Events clients and their (un)register requests.
+	sseClients    map[*sseClient]bool
+	sseRegister   chan *sseClient
+	sseUnregister chan *sseClient
+
+	// The last broadcast messages, for clients catching up.
+	backlog *wsBacklog
+	lastID  uint64
+}
+
+// Number of backlog messages sent to a websocket client in one go.
+const wsReplayChunk = 50
+
+// wsClientRequest is a request along with the client that sent it
+type wsClientRequest struct {
+	client  *WSClient
+	request *wsRequest
+}
+
+// wsClientReply is a message for a single client
+type wsClientReply struct {
+	client  *WSClient
+	message []byte
 }
 
 func newHub() *WSHub {
 	return &WSHub{
-		broadcast:  make(chan []byte),
+		broadcast:  make(chan *wsMessage),
+		requests:   make(chan *wsClientRequest),
+		replies:    make(chan *wsClientReply),
 		register:   make(chan *WSClient),
 		unregister: make(chan *WSClient),
 		clients:    make(map[*WSClient]bool),
+
+		sseClients:    make(map[*sseClient]bool),
+		sseRegister:   make(chan *sseClient),
+		sseUnregister: make(chan *sseClient),
+
+		backlog: newWSBacklog(ConfigGlobal.ServerBacklogSize, ConfigGlobal.ServerBacklogMaxAge),
 	}
 }
 
@@ -39,15 +83,131 @@ func (h *WSHub) run() {
 				delete(h.clients, client)
 				close(client.send)
 			}
+		case req := <-h.requests:
+			if _, ok := h.clients[req.client]; !ok {
+				continue
+			}
+			if req.request.Action == "replay" {
+				h.replayWS(req.client, req.request)
+				continue
+			}
+			resp, err := json.Marshal(req.client.subscription.handleRequest(req.request))
+			if err == nil {
+				h.send(req.client, resp)
+			}
+		case reply := <-h.replies:
+			if _, ok := h.clients[reply.client]; ok {
+				h.send(reply.client, reply.message)
+			}
+		case client := <-h.sseRegister:
+			h.sseClients[client] = true
+			client.backlog <- h.replay(client.subscription, client.replay)
+		case client := <-h.sseUnregister:
+			if _, ok := h.sseClients[client]; ok {
+				delete(h.sseClients, client)
+				close(client.send)
+			}
 		case message := <-h.broadcast:
+			h.lastID++
+			message.id = h.lastID
+			message.at = time.Now()
+			h.backlog.add(message)
+
 			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					close(client.send)
-					delete(h.clients, client)
+				if client.subscription.matches(message) {
+					h.send(client, message.payload)
+				}
+			}
+			for client := range h.sseClients {
+				if client.subscription.matches(message) {
+					h.sendSSE(client, message)
 				}
 			}
 		}
 	}
 }
+
+// send queues a message for a client, dropping the client if it does not keep up
+func (h *WSHub) send(client *WSClient, message []byte) {
+	select {
+	case client.send <- message:
+	default:
+		close(client.send)
+		delete(h.clients, client)
+	}
+}
+
+// sendSSE queues a message for a Server-Sent Events client, dropping the client if it does not keep up
+func (h *WSHub) sendSSE(client *sseClient, message *wsMessage) {
+	select {
+	case client.send <- message:
+	default:
+		close(client.send)
+		delete(h.sseClients, client)
+	}
+}
+
+// replay returns the backlog messages a client asked for and is subscribed to
+func (h *WSHub) replay(subscription *wsSubscription, replay *wsReplay) []*wsMessage {
+	if replay == nil {
+		return nil
+	}
+
+	afterID := replay.afterID
+	if afterID > h.lastID {
+		afterID = 0
+	}
+
+	var messages []*wsMessage
+	for _, message := range h.backlog.since(afterID, replay.after) {
+		if replay.matches(message) && subscription.matches(message) {
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
+
+// replayWS sends a websocket client the backlog it asked for, followed by the reply to its request.
+// Messages are sent in chunks of newline separated payloads, just like writePump does with queued messages.
+// Only as many chunks as fit into the client's send buffer are sent, the oldest messages are left out
+// of a larger replay and counted in the reply so the hub doesn't have to drop the client.
+func (h *WSHub) replayWS(client *WSClient, req *wsRequest) {
+	resp := &wsResponse{ID: req.ID, Action: req.Action, Filter: client.subscription.filter}
+
+	replay, err := req.replay()
+	if err != nil {
+		resp.Error = err.Error()
+	} else {
+		messages := h.replay(client.subscription, replay)
+
+		// Keep a slot for the reply
+		free := cap(client.send) - len(client.send) - 1
+		if free < 0 {
+			free = 0
+		}
+		if limit := free * wsReplayChunk; len(messages) > limit {
+			resp.Skipped = len(messages) - limit
+			messages = messages[resp.Skipped:]
+		}
+
+		for i := 0; i < len(messages); i += wsReplayChunk {
+			end := i + wsReplayChunk
+			if end > len(messages) {
+				end = len(messages)
+			}
+
+			payloads := make([][]byte, 0, end-i)
+			for _, message := range messages[i:end] {
+				payloads = append(payloads, message.payload)
+			}
+			h.send(client, bytes.Join(payloads, newline))
+		}
+		resp.Count = len(messages)
+		resp.Topics = replay.topics
+	}
+
+	data, err := json.Marshal(resp)
+	if err == nil {
+		h.send(client, data)
+	}
+}
@@ -0,0 +1,119 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ao-data/albiondata-client/db"
+)
+
+const (
+	defaultWSQueryLimit = 50
+	maxWSQueryLimit     = 1000
+
+	// How old the orders best_arbitrage pairs may be, unless the query says otherwise
+	defaultArbitrageMaxAge = time.Hour
+)
+
+// wsQueryParams are the parameters a query can take, each query uses the ones it needs
+type wsQueryParams struct {
+	ItemID      string `json:"item_id"`
+	Location    string `json:"location"`
+	AuctionType string `json:"auction_type"`
+	Limit       int    `json:"limit"`
+	MaxAge      string `json:"max_age"`
+}
+
+func (p *wsQueryParams) limit() int {
+	if p.Limit <= 0 {
+		return defaultWSQueryLimit
+	}
+	if p.Limit > maxWSQueryLimit {
+		return maxWSQueryLimit
+	}
+	return p.Limit
+}
+
+// wsQueryResponse is the answer to a query, carrying the id of the request
+type wsQueryResponse struct {
+	ID     string      `json:"id,omitempty"`
+	Action string      `json:"action"`
+	Query  string      `json:"query"`
+	Result interface{} `json:"result,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// wsOrderCounts is the result of the order_counts query
+type wsOrderCounts struct {
+	Total int `json:"total"`
+	Buy   int `json:"buy"`
+	Sell  int `json:"sell"`
+}
+
+// wsQueries are the queries websocket clients can run against the local database
+var wsQueries = map[string]func(p *wsQueryParams) (interface{}, error){
+	"latest_orders": func(p *wsQueryParams) (interface{}, error) {
+		return db.GetOrdersByFilter(p.ItemID, p.Location, p.AuctionType, p.limit())
+	},
+	"best_arbitrage": func(p *wsQueryParams) (interface{}, error) {
+		if p.ItemID == "" {
+			return nil, fmt.Errorf("item_id is required")
+		}
+		maxAge := defaultArbitrageMaxAge
+		if p.MaxAge != "" {
+			var err error
+			if maxAge, err = time.ParseDuration(p.MaxAge); err != nil {
+				return nil, fmt.Errorf("invalid max_age: %v", err)
+			}
+		}
+		return db.GetArbitrageOpportunities(p.ItemID, maxAge, p.limit())
+	},
+	"locations": func(p *wsQueryParams) (interface{}, error) {
+		return db.GetUniqueLocations()
+	},
+	"order_counts": func(p *wsQueryParams) (interface{}, error) {
+		total, err := db.GetOrderCount()
+		if err != nil {
+			return nil, err
+		}
+		buy, sell, err := db.GetOrderCountByType()
+		if err != nil {
+			return nil, err
+		}
+		return &wsOrderCounts{Total: total, Buy: buy, Sell: sell}, nil
+	},
+}
+
+// runWSQuery answers a query request from the local database
+func runWSQuery(req *wsRequest) *wsQueryResponse {
+	resp := &wsQueryResponse{ID: req.ID, Action: req.Action, Query: req.Query}
+
+	query, ok := wsQueries[req.Query]
+	if !ok {
+		resp.Error = "unknown query"
+		return resp
+	}
+
+	if db.DB == nil {
+		resp.Error = "local database is not enabled"
+		return resp
+	}
+
+	params := &wsQueryParams{}
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, params); err != nil {
+			resp.Error = fmt.Sprintf("invalid params: %v", err)
+			return resp
+		}
+	}
+
+	result, err := query(params)
+	if err != nil {
+		resp.Error = err.Error()
+		return resp
+	}
+
+	resp.Result = result
+	return resp
+}
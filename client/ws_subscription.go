@@ -0,0 +1,217 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ao-data/albiondata-client/lib"
+)
+
+// wsMessage is a message broadcast to the websocket clients, along with what
+// the clients' filters are matched against
+type wsMessage struct {
+	id        uint64
+	at        time.Time
+	topic     string
+	realm     string
+	locations []string
+	itemIDs   []string
+	payload   []byte
+}
+
+// newWSMessage collects the item and location IDs a message is about so clients can filter on them
+func newWSMessage(topic string, data []byte, state *albionState, payload []byte) *wsMessage {
+	m := &wsMessage{
+		topic:   topic,
+		realm:   realmName(state.AODataServerID),
+		payload: payload,
+	}
+
+	switch topic {
+	case lib.NatsMarketOrdersIngest:
+		upload := lib.MarketUpload{}
+		if json.Unmarshal(data, &upload) == nil {
+			for _, order := range upload.Orders {
+				m.itemIDs = appendUnique(m.itemIDs, order.ItemID)
+				m.locations = appendUnique(m.locations, order.LocationID)
+			}
+		}
+	case lib.NatsMarketHistoriesIngest:
+		// Histories only carry the numeric item ID, which item_prefix can't match,
+		// so they are left to the location and realm filters
+		upload := lib.MarketHistoriesUpload{}
+		if json.Unmarshal(data, &upload) == nil {
+			m.locations = []string{upload.LocationId}
+		}
+	}
+
+	if len(m.locations) == 0 && state.LocationId != "" {
+		m.locations = []string{state.LocationId}
+	}
+
+	return m
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+// wsFilter narrows down the messages of the subscribed topics. Empty fields match everything,
+// and a field only applies to messages that carry that information.
+type wsFilter struct {
+	ItemPrefix string `json:"item_prefix"`
+	Location   string `json:"location"`
+	Realm      string `json:"realm"`
+}
+
+// wsSubscription is what a websocket client asked to receive. Clients that never
+// subscribed receive every topic.
+type wsSubscription struct {
+	subscribed bool
+	topics     map[string]bool
+	excluded   map[string]bool
+	filter     wsFilter
+}
+
+func newWSSubscription() *wsSubscription {
+	return &wsSubscription{
+		topics:   map[string]bool{"*": true},
+		excluded: make(map[string]bool),
+	}
+}
+
+func (s *wsSubscription) matches(m *wsMessage) bool {
+	if s.excluded[m.topic] || (!s.topics[m.topic] && !s.topics["*"]) {
+		return false
+	}
+
+	f := s.filter
+	if f.Realm != "" && m.realm != "" && !strings.EqualFold(f.Realm, m.realm) {
+		return false
+	}
+
+	if f.Location != "" && len(m.locations) > 0 && !containsString(m.locations, f.Location) {
+		return false
+	}
+
+	if f.ItemPrefix != "" && len(m.itemIDs) > 0 {
+		found := false
+		for _, id := range m.itemIDs {
+			if strings.HasPrefix(id, f.ItemPrefix) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// wsRequest is a message sent by a websocket client, e.g.
+//
+//	{"action": "subscribe", "topics": ["marketorders.ingest"], "filter": {"item_prefix": "T6_", "location": "3005"}}
+//	{"action": "unsubscribe", "topics": ["marketorders.ingest"]}
+//	{"id": "1", "action": "query", "query": "best_arbitrage", "params": {"item_id": "T6_BAG", "max_age": "30m"}}
+//	{"action": "replay", "topics": ["goldprices.ingest"], "since": "10m"}
+//
+// The topic "*" stands for every topic. The optional id is sent back with the
+// answer so clients can match it to their request.
+type wsRequest struct {
+	ID     string          `json:"id"`
+	Action string          `json:"action"`
+	Topics []string        `json:"topics"`
+	Filter *wsFilter       `json:"filter"`
+	Query  string          `json:"query"`
+	Params json.RawMessage `json:"params"`
+	Since  string          `json:"since"`
+}
+
+// replay returns what a replay request asks for, the whole backlog if it does not say
+func (r *wsRequest) replay() (*wsReplay, error) {
+	replay := &wsReplay{topics: r.Topics}
+	if r.Since != "" {
+		since, err := time.ParseDuration(r.Since)
+		if err != nil {
+			return nil, fmt.Errorf("invalid since: %v", err)
+		}
+		replay.after = time.Now().Add(-since)
+	}
+	return replay, nil
+}
+
+// wsResponse is the answer to a wsRequest
+type wsResponse struct {
+	ID       string   `json:"id,omitempty"`
+	Action   string   `json:"action"`
+	Topics   []string `json:"topics,omitempty"`
+	Excluded []string `json:"excluded,omitempty"`
+	Filter   wsFilter `json:"filter"`
+	Count    int      `json:"count,omitempty"`
+	Skipped  int      `json:"skipped,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// handleRequest applies a subscribe or unsubscribe request and returns the reply for the client
+func (s *wsSubscription) handleRequest(req *wsRequest) *wsResponse {
+	switch req.Action {
+	case "subscribe":
+		if !s.subscribed {
+			// The first subscription replaces the default of every topic
+			s.subscribed = true
+			s.topics = make(map[string]bool)
+		}
+		for _, topic := range req.Topics {
+			if topic == "*" {
+				s.excluded = make(map[string]bool)
+			}
+			s.topics[topic] = true
+			delete(s.excluded, topic)
+		}
+		if req.Filter != nil {
+			s.filter = *req.Filter
+		}
+	case "unsubscribe":
+		s.subscribed = true
+		for _, topic := range req.Topics {
+			if topic == "*" {
+				s.topics = make(map[string]bool)
+				s.excluded = make(map[string]bool)
+				continue
+			}
+			delete(s.topics, topic)
+			if s.topics["*"] {
+				s.excluded[topic] = true
+			}
+		}
+	default:
+		return &wsResponse{ID: req.ID, Action: req.Action, Error: "unknown action"}
+	}
+
+	resp := &wsResponse{ID: req.ID, Action: req.Action, Filter: s.filter}
+	for topic := range s.topics {
+		resp.Topics = append(resp.Topics, topic)
+	}
+	for topic := range s.excluded {
+		resp.Excluded = append(resp.Excluded, topic)
+	}
+	return resp
+}
@@ -22,4 +22,22 @@ CREATE INDEX IF NOT EXISTS idx_captured_at ON market_orders(captured_at DESC);
 CREATE INDEX IF NOT EXISTS idx_auction_type ON market_orders(auction_type);
 CREATE INDEX IF NOT EXISTS idx_item_id ON market_orders(item_id);
 CREATE INDEX IF NOT EXISTS idx_location_id ON market_orders(location_id);
+
+CREATE TABLE IF NOT EXISTS market_searches (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    location_id TEXT NOT NULL,
+    auction_type TEXT NOT NULL,
+    category TEXT,
+    subcategory TEXT,
+    quality TEXT,
+    enchantment INTEGER,
+    item_ids TEXT,
+    result_item_ids TEXT,
+    max_results INTEGER,
+    result_count INTEGER,
+    complete INTEGER,
+    searched_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_market_searches_searched_at ON market_searches(searched_at DESC);
 `
@@ -0,0 +1,197 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const spoolSchema = `
+CREATE TABLE IF NOT EXISTS upload_spool (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    target TEXT NOT NULL,
+    topic TEXT NOT NULL,
+    body BLOB NOT NULL,
+    server_id INTEGER,
+    identifier TEXT,
+    attempts INTEGER DEFAULT 0,
+    next_attempt_at INTEGER NOT NULL,
+    created_at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_spool_next_attempt ON upload_spool(next_attempt_at);
+CREATE INDEX IF NOT EXISTS idx_spool_created_at ON upload_spool(created_at);
+`
+
+// SpoolEntry represents an upload waiting in the spool
+type SpoolEntry struct {
+	ID            int64
+	Target        string
+	Topic         string
+	Body          []byte
+	ServerID      int
+	Identifier    string
+	Attempts      int
+	NextAttemptAt time.Time
+
+	// When the upload was captured, the time it is spooled at if not given
+	CreatedAt time.Time
+}
+
+// Spool is a persistent queue of uploads that could not be delivered yet.
+// It is kept in its own SQLite file so it works without the market database.
+type Spool struct {
+	db *sql.DB
+	mu sync.Mutex
+}
+
+// OpenSpool opens (or creates) the upload spool at the given path
+func OpenSpool(path string) (*Spool, error) {
+	conn, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open spool: %w", err)
+	}
+
+	// A single connection avoids SQLITE_BUSY between the uploader and the retry loop
+	conn.SetMaxOpenConns(1)
+
+	_, err = conn.Exec(spoolSchema)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create spool schema: %w", err)
+	}
+
+	return &Spool{db: conn}, nil
+}
+
+// Push adds an upload to the spool, due for its first retry at nextAttempt
+func (s *Spool) Push(entry *SpoolEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = now
+	}
+	if entry.NextAttemptAt.IsZero() {
+		entry.NextAttemptAt = now
+	}
+
+	result, err := s.db.Exec(`
+		INSERT INTO upload_spool (
+			target, topic, body, server_id, identifier,
+			attempts, next_attempt_at, created_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		entry.Target,
+		entry.Topic,
+		entry.Body,
+		entry.ServerID,
+		entry.Identifier,
+		entry.Attempts,
+		entry.NextAttemptAt.UnixNano(),
+		entry.CreatedAt.UnixNano(),
+	)
+	if err != nil {
+		return err
+	}
+
+	entry.ID, err = result.LastInsertId()
+	return err
+}
+
+// Due returns up to limit entries whose next attempt is at or before now, oldest first
+func (s *Spool) Due(now time.Time, limit int) ([]*SpoolEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rows, err := s.db.Query(`
+		SELECT id, target, topic, body, server_id, identifier,
+		       attempts, next_attempt_at, created_at
+		FROM upload_spool
+		WHERE next_attempt_at <= ?
+		ORDER BY next_attempt_at, id
+		LIMIT ?
+	`, now.UnixNano(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*SpoolEntry
+	for rows.Next() {
+		entry := &SpoolEntry{}
+		var nextAttempt, created int64
+		err := rows.Scan(
+			&entry.ID,
+			&entry.Target,
+			&entry.Topic,
+			&entry.Body,
+			&entry.ServerID,
+			&entry.Identifier,
+			&entry.Attempts,
+			&nextAttempt,
+			&created,
+		)
+		if err != nil {
+			return nil, err
+		}
+		entry.NextAttemptAt = time.Unix(0, nextAttempt)
+		entry.CreatedAt = time.Unix(0, created)
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// Reschedule records a failed attempt and sets the time of the next one
+func (s *Spool) Reschedule(id int64, attempts int, nextAttempt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.Exec(
+		"UPDATE upload_spool SET attempts = ?, next_attempt_at = ? WHERE id = ?",
+		attempts, nextAttempt.UnixNano(), id,
+	)
+	return err
+}
+
+// Delete removes a delivered entry from the spool
+func (s *Spool) Delete(id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.Exec("DELETE FROM upload_spool WHERE id = ?", id)
+	return err
+}
+
+// Prune drops every entry created before the cutoff and returns how many were removed
+func (s *Spool) Prune(cutoff time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result, err := s.db.Exec("DELETE FROM upload_spool WHERE created_at < ?", cutoff.UnixNano())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Depth returns the number of uploads waiting in the spool
+func (s *Spool) Depth() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var count int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM upload_spool").Scan(&count)
+	return count, err
+}
+
+// Close closes the spool database
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.db.Close()
+}
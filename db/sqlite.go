@@ -3,6 +3,8 @@ package db
 import (
 	"database/sql"
 	"fmt"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -31,6 +33,9 @@ var (
 	mu sync.Mutex
 )
 
+// sqliteTimeFormat is how SQLite writes times, e.g. for CURRENT_TIMESTAMP
+const sqliteTimeFormat = "2006-01-02 15:04:05"
+
 // InitDB initializes the SQLite database
 func InitDB(dbPath string) error {
 	mu.Lock()
@@ -86,6 +91,57 @@ func InsertMarketOrder(order *lib.MarketOrder) error {
 	return err
 }
 
+// MarketSearch is a search of the market made in the game, along with what it returned.
+// A complete search returned fewer orders than it asked for, so there are no other orders for it.
+type MarketSearch struct {
+	LocationID    string
+	AuctionType   string
+	Category      string
+	SubCategory   string
+	Quality       string
+	Enchantment   int
+	ItemIDs       []int
+	ResultItemIDs []string
+	MaxResults    int
+	ResultCount   int
+	Complete      bool
+}
+
+// InsertMarketSearch records a market search
+func InsertMarketSearch(search *MarketSearch) error {
+	if DB == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	itemIDs := make([]string, len(search.ItemIDs))
+	for i, id := range search.ItemIDs {
+		itemIDs[i] = strconv.Itoa(id)
+	}
+
+	query := `
+		INSERT INTO market_searches (
+			location_id, auction_type, category, subcategory, quality,
+			enchantment, item_ids, result_item_ids, max_results, result_count, complete
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err := DB.Exec(query,
+		search.LocationID,
+		search.AuctionType,
+		search.Category,
+		search.SubCategory,
+		search.Quality,
+		search.Enchantment,
+		strings.Join(itemIDs, ","),
+		strings.Join(search.ResultItemIDs, ","),
+		search.MaxResults,
+		search.ResultCount,
+		search.Complete,
+	)
+
+	return err
+}
+
 // GetRecentOrders retrieves the most recent market orders
 func GetRecentOrders(limit int) ([]*MarketOrderDB, error) {
 	if DB == nil {
@@ -205,6 +261,75 @@ func GetUniqueLocations() ([]string, error) {
 	return locations, rows.Err()
 }
 
+// ArbitrageOpportunity is the difference between the cheapest sell order of an item
+// in one location and the highest buy order for it in another
+type ArbitrageOpportunity struct {
+	ItemID         string
+	QualityLevel   int
+	BuyFrom        string
+	BuyPrice       int
+	SellTo         string
+	SellPrice      int
+	Profit         int
+	ProfitAfterTax int
+}
+
+// GetArbitrageOpportunities returns the most profitable ways to buy an item from a sell order
+// and fill a buy order with it, for items of the same quality. Only orders that have not expired
+// and were captured within maxAge are taken into account.
+func GetArbitrageOpportunities(itemID string, maxAge time.Duration, limit int) ([]*ArbitrageOpportunity, error) {
+	if DB == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	// In the format of CURRENT_TIMESTAMP and datetime(), which compare as strings
+	now := time.Now().UTC()
+	nowText := now.Format(sqliteTimeFormat)
+	capturedAfter := now.Add(-maxAge).Format(sqliteTimeFormat)
+
+	rows, err := DB.Query(`
+		WITH live AS (
+			SELECT item_id, quality_level, location_id, price, auction_type
+			FROM market_orders
+			WHERE item_id = ? AND datetime(expires) > ? AND captured_at >= ?
+		), sells AS (
+			SELECT item_id, quality_level, location_id, MIN(price) AS price
+			FROM live
+			WHERE auction_type = 'offer'
+			GROUP BY item_id, quality_level, location_id
+		), buys AS (
+			SELECT item_id, quality_level, location_id, MAX(price) AS price
+			FROM live
+			WHERE auction_type = 'request'
+			GROUP BY item_id, quality_level, location_id
+		)
+		SELECT s.item_id, s.quality_level, s.location_id, s.price, b.location_id, b.price
+		FROM sells s
+		JOIN buys b ON b.item_id = s.item_id AND b.quality_level = s.quality_level
+		WHERE b.price > s.price
+		ORDER BY b.price - s.price DESC
+		LIMIT ?
+	`, itemID, nowText, capturedAfter, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var opportunities []*ArbitrageOpportunity
+	for rows.Next() {
+		o := &ArbitrageOpportunity{}
+		err := rows.Scan(&o.ItemID, &o.QualityLevel, &o.BuyFrom, &o.BuyPrice, &o.SellTo, &o.SellPrice)
+		if err != nil {
+			return nil, err
+		}
+		o.Profit = o.SellPrice - o.BuyPrice
+		o.ProfitAfterTax = int(float64(o.SellPrice)*(1-lib.SalesTax)) - o.BuyPrice
+		opportunities = append(opportunities, o)
+	}
+
+	return opportunities, rows.Err()
+}
+
 // scanOrders scans SQL rows into MarketOrderDB structs
 func scanOrders(rows *sql.Rows) ([]*MarketOrderDB, error) {
 	var orders []*MarketOrderDB
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ao-data/albiondata-client/lib"
+)
+
+// openTestDB initializes a database in a temporary directory while the test runs
+func openTestDB(t *testing.T) {
+	if err := InitDB(filepath.Join(t.TempDir(), "market.db")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		Close()
+		DB = nil
+	})
+}
+
+// gameTime formats a time the way the game sends order expiry times
+func gameTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000000")
+}
+
+func TestGetArbitrageOpportunities(t *testing.T) {
+	openTestDB(t)
+
+	now := time.Now()
+	live := gameTime(now.Add(24 * time.Hour))
+	orders := []*lib.MarketOrder{
+		{ID: 1, ItemID: "T4_BAG", LocationID: "3005", QualityLevel: 1, Price: 1000, AuctionType: "offer", Expires: live},
+		{ID: 2, ItemID: "T4_BAG", LocationID: "0007", QualityLevel: 1, Price: 1500, AuctionType: "request", Expires: live},
+		// Cheaper, but expired
+		{ID: 3, ItemID: "T4_BAG", LocationID: "4002", QualityLevel: 1, Price: 100, AuctionType: "offer", Expires: gameTime(now.Add(-time.Hour))},
+		// Pays more, but captured too long ago
+		{ID: 4, ItemID: "T4_BAG", LocationID: "1002", QualityLevel: 1, Price: 5000, AuctionType: "request", Expires: live},
+	}
+	for _, order := range orders {
+		if err := InsertMarketOrder(order); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stale := now.Add(-3 * time.Hour).UTC().Format(sqliteTimeFormat)
+	if _, err := DB.Exec("UPDATE market_orders SET captured_at = ? WHERE order_id = 4", stale); err != nil {
+		t.Fatal(err)
+	}
+
+	opportunities, err := GetArbitrageOpportunities("T4_BAG", time.Hour, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(opportunities) != 1 {
+		t.Fatalf("got %d opportunities, wanted only the one of the live orders", len(opportunities))
+	}
+
+	o := opportunities[0]
+	if o.BuyFrom != "3005" || o.BuyPrice != 1000 || o.SellTo != "0007" || o.SellPrice != 1500 {
+		t.Errorf("got buying at %v for %d and selling at %v for %d", o.BuyFrom, o.BuyPrice, o.SellTo, o.SellPrice)
+	}
+	if o.Profit != 500 || o.ProfitAfterTax != 455 {
+		t.Errorf("got profit %d and %d after tax", o.Profit, o.ProfitAfterTax)
+	}
+
+	// The stale order counts again within a longer window
+	opportunities, err = GetArbitrageOpportunities("T4_BAG", 4*time.Hour, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(opportunities) != 2 || opportunities[0].SellTo != "1002" {
+		t.Errorf("got %d opportunities with a window covering the stale order", len(opportunities))
+	}
+}
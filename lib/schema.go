@@ -0,0 +1,25 @@
+package lib
+
+import "embed"
+
+// EnvelopeSchemaVersion is the version of the envelope wrapping messages sent to local consumers
+const EnvelopeSchemaVersion = 1
+
+// SchemaVersions holds the current schema version of the payload of every topic.
+// Bump the version and update the matching file in schema/ whenever an upload struct changes.
+var SchemaVersions = map[string]int{
+	NatsMarketOrdersIngest:    1,
+	NatsMarketHistoriesIngest: 1,
+	NatsGoldPricesIngest:      1,
+	NatsMapDataIngest:         1,
+	NatsSkillData:             1,
+	NatsMarketNotifications:   1,
+}
+
+//go:embed schema/*.json
+var schemas embed.FS
+
+// Schema returns the JSON Schema of the payload of a topic, or of the envelope for "envelope"
+func Schema(name string) ([]byte, error) {
+	return schemas.ReadFile("schema/" + name + ".json")
+}
@@ -0,0 +1,104 @@
+package photonsynth
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	photon "github.com/ao-data/photon_spectator"
+)
+
+// Bytes of the header of a fragment, in front of its part of the message.
+const fragmentHeaderLength = 20
+
+// Reliable returns the message as a reliable command
+func Reliable(msg Message, sequence int32) (photon.PhotonCommand, error) {
+	data, err := msg.Encode()
+	if err != nil {
+		return photon.PhotonCommand{}, err
+	}
+	return newCommand(photon.SendReliableType, sequence, data), nil
+}
+
+// Unreliable returns the message as an unreliable command, which starts with its own sequence number
+func Unreliable(msg Message, sequence int32) (photon.PhotonCommand, error) {
+	data, err := msg.Encode()
+	if err != nil {
+		return photon.PhotonCommand{}, err
+	}
+
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.BigEndian, sequence)
+	buf.Write(data)
+	return newCommand(photon.SendUnreliableType, sequence, buf.Bytes()), nil
+}
+
+// Fragmented returns the message split into fragments of at most size bytes, like the game does
+// with messages too large for a packet. The fragments take the sequence numbers from sequence on.
+func Fragmented(msg Message, sequence int32, size int) ([]photon.PhotonCommand, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid fragment size %d", size)
+	}
+
+	data, err := msg.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	count := (len(data) + size - 1) / size
+	commands := make([]photon.PhotonCommand, 0, count)
+	for i := 0; i < count; i++ {
+		offset := i * size
+		end := offset + size
+		if end > len(data) {
+			end = len(data)
+		}
+
+		buf := &bytes.Buffer{}
+		binary.Write(buf, binary.BigEndian, sequence)
+		binary.Write(buf, binary.BigEndian, int32(count))
+		binary.Write(buf, binary.BigEndian, int32(i))
+		binary.Write(buf, binary.BigEndian, int32(len(data)))
+		binary.Write(buf, binary.BigEndian, int32(offset))
+		buf.Write(data[offset:end])
+
+		commands = append(commands, newCommand(photon.SendReliableFragmentType, sequence+int32(i), buf.Bytes()))
+	}
+
+	return commands, nil
+}
+
+func newCommand(commandType uint8, sequence int32, data []byte) photon.PhotonCommand {
+	return photon.PhotonCommand{
+		Type:                   commandType,
+		Length:                 int32(photon.PhotonCommandHeaderLength + len(data)),
+		ReliableSequenceNumber: sequence,
+		Data:                   data,
+	}
+}
+
+// Packet returns the commands as the payload of a UDP packet
+func Packet(peerID uint16, timestamp uint32, commands ...photon.PhotonCommand) ([]byte, error) {
+	if len(commands) > 0xFF {
+		return nil, fmt.Errorf("%d commands do not fit into a packet", len(commands))
+	}
+
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.BigEndian, peerID)
+	buf.WriteByte(0) // No CRC
+	buf.WriteByte(uint8(len(commands)))
+	binary.Write(buf, binary.BigEndian, timestamp)
+	binary.Write(buf, binary.BigEndian, int32(0)) // Challenge
+
+	for _, command := range commands {
+		buf.WriteByte(command.Type)
+		buf.WriteByte(command.ChannelID)
+		buf.WriteByte(command.Flags)
+		buf.WriteByte(command.ReservedByte)
+		binary.Write(buf, binary.BigEndian, int32(photon.PhotonCommandHeaderLength+len(command.Data)))
+		binary.Write(buf, binary.BigEndian, command.ReliableSequenceNumber)
+		buf.Write(command.Data)
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,287 @@
+// Package photonsynth builds Photon messages, commands and packets the way the game server sends
+// them, so the client can be fed fabricated market responses and other traffic without the game.
+// Params are encoded with the type codes photon_spectator decodes, e.g.
+//
+//	msg := photonsynth.Response(76, map[uint8]interface{}{0: []string{`{"ItemTypeId":"T4_BAG"}`}})
+//	command, err := photonsynth.Reliable(msg, 1)
+//
+// Go types map to Photon types as follows: nil, int8, int16, int32, int64, float32, bool and
+// string to the matching type, []int8 and []byte to Int8SliceType, other slices of those to
+// SliceType, and maps to DictionaryType. The keys and the values of a map must all have the same
+// type, as photon_spectator does not read a type per entry.
+package photonsynth
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"sort"
+
+	photon "github.com/ao-data/photon_spectator"
+)
+
+// Albion sends every message with the same code in the header, the actual one is param 253 for
+// operations and param 252 for events.
+const (
+	headerCode      = 1
+	operationParam  = 253
+	eventParam      = 252
+	photonSignature = 0xF3
+)
+
+// Message is a Photon message, its params are encoded in the order of their index
+type Message struct {
+	Type   uint8
+	Params map[uint8]interface{}
+}
+
+// Request returns an operation request with the code as param 253
+func Request(code int16, params map[uint8]interface{}) Message {
+	return newMessage(photon.OperationRequest, operationParam, code, params)
+}
+
+// Response returns an operation response with the code as param 253
+func Response(code int16, params map[uint8]interface{}) Message {
+	return newMessage(photon.OperationResponse, operationParam, code, params)
+}
+
+// Event returns an event with the code as param 252
+func Event(code int16, params map[uint8]interface{}) Message {
+	return newMessage(photon.EventDataType, eventParam, code, params)
+}
+
+func newMessage(messageType uint8, codeParam uint8, code int16, params map[uint8]interface{}) Message {
+	msg := Message{Type: messageType, Params: make(map[uint8]interface{}, len(params)+1)}
+	for index, value := range params {
+		msg.Params[index] = value
+	}
+	msg.Params[codeParam] = code
+	return msg
+}
+
+// Encode returns the message as the data of a reliable command
+func (m Message) Encode() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteByte(photonSignature)
+	buf.WriteByte(m.Type)
+
+	switch m.Type {
+	case photon.OperationRequest, photon.EventDataType:
+		buf.WriteByte(headerCode)
+	case photon.OperationResponse:
+		buf.WriteByte(headerCode)
+		// Return code and an empty debug message
+		binary.Write(buf, binary.BigEndian, uint16(0))
+		buf.WriteByte(photon.NilType)
+	default:
+		return nil, fmt.Errorf("unsupported message type %d", m.Type)
+	}
+
+	indices := make([]int, 0, len(m.Params))
+	for index := range m.Params {
+		indices = append(indices, int(index))
+	}
+	sort.Ints(indices)
+
+	binary.Write(buf, binary.BigEndian, int16(len(indices)))
+	for _, index := range indices {
+		buf.WriteByte(uint8(index))
+		if err := writeTyped(buf, m.Params[uint8(index)]); err != nil {
+			return nil, fmt.Errorf("param %d: %v", index, err)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// writeTyped writes the type code of a value followed by the value
+func writeTyped(buf *bytes.Buffer, value interface{}) error {
+	if value == nil {
+		buf.WriteByte(photon.NilType)
+		return nil
+	}
+
+	v := reflect.ValueOf(value)
+	code, err := typeCode(v.Type())
+	if err != nil {
+		return err
+	}
+
+	buf.WriteByte(code)
+	return writeValue(buf, v, code)
+}
+
+// typeCode returns the Photon type of a Go type
+func typeCode(t reflect.Type) (uint8, error) {
+	switch t.Kind() {
+	case reflect.Int8:
+		return photon.Int8Type, nil
+	case reflect.Int16:
+		return photon.Int16Type, nil
+	case reflect.Int32:
+		return photon.Int32Type, nil
+	case reflect.Int64:
+		return photon.Int64Type, nil
+	case reflect.Float32:
+		return photon.Float32Type, nil
+	case reflect.Bool:
+		return photon.BooleanType, nil
+	case reflect.String:
+		return photon.StringType, nil
+	case reflect.Slice:
+		if kind := t.Elem().Kind(); kind == reflect.Int8 || kind == reflect.Uint8 {
+			return photon.Int8SliceType, nil
+		}
+		return photon.SliceType, nil
+	case reflect.Map:
+		return photon.DictionaryType, nil
+	}
+
+	return 0, fmt.Errorf("unsupported type %v", t)
+}
+
+// writeValue writes a value of the given Photon type, without the type code
+func writeValue(buf *bytes.Buffer, v reflect.Value, code uint8) error {
+	switch code {
+	case photon.Int8Type:
+		buf.WriteByte(uint8(v.Int()))
+	case photon.Int16Type:
+		binary.Write(buf, binary.BigEndian, int16(v.Int()))
+	case photon.Int32Type:
+		binary.Write(buf, binary.BigEndian, int32(v.Int()))
+	case photon.Int64Type:
+		binary.Write(buf, binary.BigEndian, v.Int())
+	case photon.Float32Type:
+		binary.Write(buf, binary.BigEndian, float32(v.Float()))
+	case photon.BooleanType:
+		if v.Bool() {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+	case photon.StringType:
+		s := v.String()
+		if len(s) > 0xFFFF {
+			return fmt.Errorf("string of %d bytes is too long", len(s))
+		}
+		binary.Write(buf, binary.BigEndian, uint16(len(s)))
+		buf.WriteString(s)
+	case photon.Int8SliceType:
+		binary.Write(buf, binary.BigEndian, uint32(v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			elem := v.Index(i)
+			if elem.Kind() == reflect.Uint8 {
+				buf.WriteByte(uint8(elem.Uint()))
+			} else {
+				buf.WriteByte(uint8(elem.Int()))
+			}
+		}
+	case photon.SliceType:
+		return writeSlice(buf, v)
+	case photon.DictionaryType:
+		return writeDictionary(buf, v)
+	default:
+		return fmt.Errorf("unsupported type code %d", code)
+	}
+
+	return nil
+}
+
+// writeSlice writes a SliceType, photon_spectator reads these element types from it
+func writeSlice(buf *bytes.Buffer, v reflect.Value) error {
+	if v.Len() > 0xFFFF {
+		return fmt.Errorf("slice of %d elements is too long", v.Len())
+	}
+
+	code, err := typeCode(v.Type().Elem())
+	if err != nil {
+		return err
+	}
+	switch code {
+	case photon.Float32Type, photon.Int32Type, photon.Int16Type, photon.Int64Type, photon.StringType,
+		photon.BooleanType, photon.Int8SliceType, photon.SliceType:
+	default:
+		return fmt.Errorf("unsupported slice of %v", v.Type().Elem())
+	}
+
+	binary.Write(buf, binary.BigEndian, uint16(v.Len()))
+	buf.WriteByte(code)
+	for i := 0; i < v.Len(); i++ {
+		if err := writeValue(buf, v.Index(i), code); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeDictionary writes a DictionaryType, the types of its keys and values are taken from the
+// first entry, or from the map type when it does not use interface{}
+func writeDictionary(buf *bytes.Buffer, v reflect.Value) error {
+	if v.Len() > 0xFFFF {
+		return fmt.Errorf("map of %d entries is too long", v.Len())
+	}
+
+	keys := v.MapKeys()
+	// Sorted, so the same map always results in the same bytes
+	sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+
+	keyCode, err := dictionaryCode(v.Type().Key(), keys)
+	if err != nil {
+		return fmt.Errorf("map keys: %v", err)
+	}
+	values := make([]reflect.Value, len(keys))
+	for i, key := range keys {
+		values[i] = v.MapIndex(key)
+	}
+	valueCode, err := dictionaryCode(v.Type().Elem(), values)
+	if err != nil {
+		return fmt.Errorf("map values: %v", err)
+	}
+
+	buf.WriteByte(keyCode)
+	buf.WriteByte(valueCode)
+	binary.Write(buf, binary.BigEndian, uint16(len(keys)))
+	for i, key := range keys {
+		if err := writeEntry(buf, key, keyCode); err != nil {
+			return err
+		}
+		if err := writeEntry(buf, values[i], valueCode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dictionaryCode returns the one type all keys or values of a map have
+func dictionaryCode(t reflect.Type, entries []reflect.Value) (uint8, error) {
+	if t.Kind() != reflect.Interface {
+		return typeCode(t)
+	}
+
+	code := uint8(photon.NilType)
+	for i, entry := range entries {
+		entryCode := uint8(photon.NilType)
+		if !entry.IsNil() {
+			var err error
+			if entryCode, err = typeCode(entry.Elem().Type()); err != nil {
+				return 0, err
+			}
+		}
+		if i > 0 && entryCode != code {
+			return 0, fmt.Errorf("mixed types are not supported")
+		}
+		code = entryCode
+	}
+	return code, nil
+}
+
+func writeEntry(buf *bytes.Buffer, v reflect.Value, code uint8) error {
+	if v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	return writeValue(buf, v, code)
+}
@@ -0,0 +1,186 @@
+package photonsynth
+
+import (
+	"reflect"
+	"testing"
+
+	photon "github.com/ao-data/photon_spectator"
+)
+
+// decode reads a message back the way the listener does
+func decode(t *testing.T, command photon.PhotonCommand) (photon.ReliableMessage, map[uint8]interface{}) {
+	t.Helper()
+	msg, err := command.ReliableMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg, photon.DecodeReliableMessage(msg)
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    interface{}
+		expected interface{}
+	}{
+		{"nil", nil, nil},
+		{"int8", int8(-5), int8(-5)},
+		{"int16", int16(-1234), int16(-1234)},
+		{"int32", int32(123456789), int32(123456789)},
+		{"int64", int64(638396640000000000), int64(638396640000000000)},
+		{"float32", float32(1.5), float32(1.5)},
+		{"bool", true, true},
+		{"string", "T4_BAG", "T4_BAG"},
+		{"int8 slice", []int8{1, -2, 3}, []int8{1, -2, 3}},
+		{"byte slice", []byte{1, 0xFE, 3}, []int8{1, -2, 3}},
+		{"int16 slice", []int16{1234, -1}, []int16{1234, -1}},
+		{"int32 slice", []int32{4800, 4810}, []int32{4800, 4810}},
+		{"int64 slice", []int64{1, -1}, []int64{1, -1}},
+		{"float32 slice", []float32{0.5, 2}, []float32{0.5, 2}},
+		{"bool slice", []bool{true, false}, []bool{true, false}},
+		{"string slice", []string{`{"Id":1}`, ""}, []string{`{"Id":1}`, ""}},
+		{"slice of int8 slices", [][]int8{{1}, {2, 3}}, [][]int8{{1}, {2, 3}}},
+		{"nested slices", [][]int32{{1, 2}, {3}}, []interface{}{[]int32{1, 2}, []int32{3}}},
+		{"nested string slices", [][]string{{"a"}, {}}, []interface{}{[]string{"a"}, []string{}}},
+		{
+			"dictionary",
+			map[string]int32{"T4_BAG": 1, "T5_BAG": 2},
+			map[interface{}]interface{}{"T4_BAG": int32(1), "T5_BAG": int32(2)},
+		},
+		{
+			"dictionary of interfaces",
+			map[interface{}]interface{}{int16(1): []string{"a"}, int16(2): []string{"b", "c"}},
+			map[interface{}]interface{}{int16(1): []string{"a"}, int16(2): []string{"b", "c"}},
+		},
+		{
+			"dictionary of dictionaries",
+			map[int8]map[string]bool{1: {"x": true}},
+			map[interface{}]interface{}{int8(1): map[interface{}]interface{}{"x": true}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, msg := range []Message{
+				Request(76, map[uint8]interface{}{0: test.value}),
+				Response(76, map[uint8]interface{}{0: test.value}),
+				Event(10, map[uint8]interface{}{0: test.value}),
+			} {
+				command, err := Reliable(msg, 1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				decoded, params := decode(t, command)
+				if decoded.Type != msg.Type {
+					t.Errorf("message of type %d read back as %d", msg.Type, decoded.Type)
+				}
+				if !reflect.DeepEqual(params[0], test.expected) {
+					t.Errorf("message of type %d: read back %#v, wanted %#v", msg.Type, params[0], test.expected)
+				}
+				if code := params[operationParam]; msg.Type != photon.EventDataType && code != int16(76) {
+					t.Errorf("operation code read back as %v", code)
+				}
+				if code := params[eventParam]; msg.Type == photon.EventDataType && code != int16(10) {
+					t.Errorf("event code read back as %v", code)
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeParamsInOrder(t *testing.T) {
+	msg := Response(2, map[uint8]interface{}{8: "3005", 1: []int8{1, 2}, 2: "Trader", 255: int16(7)})
+	command, err := Reliable(msg, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, params := decode(t, command)
+	if decoded.ParamaterCount != 5 {
+		t.Errorf("%d params, wanted 5", decoded.ParamaterCount)
+	}
+	expected := map[uint8]interface{}{1: []int8{1, 2}, 2: "Trader", 8: "3005", 253: int16(2), 255: int16(7)}
+	if !reflect.DeepEqual(params, expected) {
+		t.Errorf("read back %v, wanted %v", params, expected)
+	}
+}
+
+func TestEncodeUnsupported(t *testing.T) {
+	tests := map[string]interface{}{
+		"uint32":             uint32(1),
+		"slice of maps":      []map[string]int32{{"a": 1}},
+		"mixed map values":   map[string]interface{}{"a": int32(1), "b": "c"},
+		"slice of int slice": [][]int{{1}},
+	}
+
+	for name, value := range tests {
+		if _, err := Event(1, map[uint8]interface{}{0: value}).Encode(); err == nil {
+			t.Errorf("%v was encoded", name)
+		}
+	}
+}
+
+func TestUnreliableRoundTrip(t *testing.T) {
+	msg := Event(10, map[uint8]interface{}{0: "unreliable"})
+	command, err := Unreliable(msg, 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if command.Type != photon.SendUnreliableType {
+		t.Fatalf("command of type %d", command.Type)
+	}
+
+	// The listener drops the sequence number in front and reads the rest as a reliable command
+	command.Type = photon.SendReliableType
+	command.Data = command.Data[4:]
+	if _, params := decode(t, command); params[0] != "unreliable" {
+		t.Errorf("read back %v", params)
+	}
+}
+
+func TestFragmentedRoundTrip(t *testing.T) {
+	orders := make([]string, 50)
+	for i := range orders {
+		orders[i] = `{"Id":1,"ItemTypeId":"T4_BAG","UnitPriceSilver":25000000,"Amount":3}`
+	}
+	msg := Response(76, map[uint8]interface{}{0: orders, 255: int16(3)})
+
+	fragments, err := Fragmented(msg, 100, 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fragments) < 2 {
+		t.Fatalf("split into %d fragments", len(fragments))
+	}
+
+	buffer := photon.NewFragmentBuffer()
+	var reassembled *photon.PhotonCommand
+	// The game does not always send fragments in order
+	for i := len(fragments) - 1; i >= 0; i-- {
+		if fragments[i].Type != photon.SendReliableFragmentType {
+			t.Fatalf("fragment of type %d", fragments[i].Type)
+		}
+		fragment, err := fragments[i].ReliableFragment()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reassembled != nil {
+			t.Fatalf("reassembled before fragment %d", i)
+		}
+		reassembled = buffer.Offer(fragment)
+	}
+	if reassembled == nil {
+		t.Fatal("fragments were not reassembled")
+	}
+
+	_, params := decode(t, *reassembled)
+	if !reflect.DeepEqual(params[0], orders) || params[255] != int16(3) {
+		t.Errorf("reassembled message has params %v", params)
+	}
+}
+
+func TestFragmentedInvalidSize(t *testing.T) {
+	if _, err := Fragmented(Event(1, nil), 1, 0); err == nil {
+		t.Error("no error for a fragment size of 0")
+	}
+}
@@ -0,0 +1,126 @@
+package photonsynth
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	photon "github.com/ao-data/photon_spectator"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// PcapWriter writes commands as UDP packets between a client and a game server to a pcap file,
+// which the client reads with -o
+type PcapWriter struct {
+	ClientIP   net.IP
+	ClientPort int
+	// The client takes the realm from the address of the game server, 5.188.125.x is the Americas
+	ServerIP   net.IP
+	ServerPort int
+	PeerID     uint16
+
+	// Time of the next packet, each packet is Interval after the one before
+	Time     time.Time
+	Interval time.Duration
+
+	w *pcapgo.Writer
+}
+
+// NewPcapWriter writes the pcap file header and returns a writer for the packets
+func NewPcapWriter(w io.Writer) (*PcapWriter, error) {
+	pw := pcapgo.NewWriter(w)
+	if err := pw.WriteFileHeader(65536, layers.LinkTypeEthernet); err != nil {
+		return nil, err
+	}
+
+	return &PcapWriter{
+		ClientIP:   net.IPv4(192, 168, 1, 2),
+		ClientPort: 50000,
+		ServerIP:   net.IPv4(5, 188, 125, 10),
+		ServerPort: 5056,
+		PeerID:     1,
+		Time:       time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Interval:   time.Millisecond,
+		w:          pw,
+	}, nil
+}
+
+// WriteFromServer writes a packet with the commands sent by the game server
+func (p *PcapWriter) WriteFromServer(commands ...photon.PhotonCommand) error {
+	return p.write(p.ServerIP, p.ServerPort, p.ClientIP, p.ClientPort, commands)
+}
+
+// WriteFromClient writes a packet with the commands sent by the game client
+func (p *PcapWriter) WriteFromClient(commands ...photon.PhotonCommand) error {
+	return p.write(p.ClientIP, p.ClientPort, p.ServerIP, p.ServerPort, commands)
+}
+
+func (p *PcapWriter) write(srcIP net.IP, srcPort int, dstIP net.IP, dstPort int, commands []photon.PhotonCommand) error {
+	payload, err := Packet(p.PeerID, uint32(p.Time.UnixNano()/int64(time.Millisecond)), commands...)
+	if err != nil {
+		return err
+	}
+
+	eth := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0x02, 0, 0, 0, 0, 1},
+		DstMAC:       net.HardwareAddr{0x02, 0, 0, 0, 0, 2},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip := &layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: layers.IPProtocolUDP,
+		SrcIP:    srcIP.To4(),
+		DstIP:    dstIP.To4(),
+	}
+	udp := &layers.UDP{
+		SrcPort: layers.UDPPort(srcPort),
+		DstPort: layers.UDPPort(dstPort),
+	}
+	if err := udp.SetNetworkLayerForChecksum(ip); err != nil {
+		return err
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	options := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, options, eth, ip, udp, gopacket.Payload(payload)); err != nil {
+		return err
+	}
+
+	data := buf.Bytes()
+	info := gopacket.CaptureInfo{Timestamp: p.Time, CaptureLength: len(data), Length: len(data)}
+	p.Time = p.Time.Add(p.Interval)
+	return p.w.WritePacket(info, data)
+}
+
+// GobWriter writes commands the way -record does, for replaying with -o or in the golden tests of the client.
+// Recordings only hold reliable commands, as the listener puts fragments together before recording.
+type GobWriter struct {
+	encoder *gob.Encoder
+}
+
+// NewGobWriter returns a writer for a recording
+func NewGobWriter(w io.Writer) *GobWriter {
+	return &GobWriter{encoder: gob.NewEncoder(w)}
+}
+
+// Write adds commands to the recording. It fails on any command that isn't reliable, e.g. one
+// made with Unreliable or Fragmented, as a replay could not decode it.
+func (g *GobWriter) Write(commands ...photon.PhotonCommand) error {
+	for _, command := range commands {
+		if command.Type != photon.SendReliableType {
+			return fmt.Errorf("command of type %d is not reliable, only reliable commands are recorded", command.Type)
+		}
+	}
+
+	for _, command := range commands {
+		if err := g.encoder.Encode(command); err != nil {
+			return err
+		}
+	}
+	return nil
+}
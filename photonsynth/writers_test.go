@@ -0,0 +1,53 @@
+package photonsynth
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+	"reflect"
+	"testing"
+
+	photon "github.com/ao-data/photon_spectator"
+)
+
+func TestGobWriter(t *testing.T) {
+	msg := Response(76, map[uint8]interface{}{0: []string{`{"ItemTypeId":"T4_BAG"}`}})
+	reliable, err := Reliable(msg, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := NewGobWriter(buf).Write(reliable); err != nil {
+		t.Fatal(err)
+	}
+
+	var command photon.PhotonCommand
+	decoder := gob.NewDecoder(buf)
+	if err := decoder.Decode(&command); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(command, reliable) {
+		t.Errorf("read back %+v, wanted %+v", command, reliable)
+	}
+	if err := decoder.Decode(&command); err != io.EOF {
+		t.Errorf("more than one command recorded: %v", err)
+	}
+}
+
+func TestGobWriterRejectsUnreliable(t *testing.T) {
+	msg := Event(10, map[uint8]interface{}{0: int32(1)})
+	reliable, _ := Reliable(msg, 1)
+	unreliable, _ := Unreliable(msg, 2)
+	fragments, _ := Fragmented(msg, 3, 4)
+
+	for _, command := range append([]photon.PhotonCommand{unreliable}, fragments...) {
+		buf := &bytes.Buffer{}
+		if err := NewGobWriter(buf).Write(reliable, command); err == nil {
+			t.Errorf("command of type %d was recorded", command.Type)
+		}
+		if buf.Len() > 0 {
+			t.Errorf("wrote %d bytes before rejecting a command of type %d", buf.Len(), command.Type)
+		}
+	}
+}